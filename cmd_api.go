@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/api"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout to finish the requests in course when the server stops
+const shutdownTimeout = 10 * time.Second
+
+// apiServe runs the REST API until the context is cancelled, the metrics
+// of the store are served in /metrics
+func apiServe(ctx context.Context, a *app, args []string) error {
+	var addr string
+	var taxRate uint
+	fs := newFlagSet("api serve", a.stderr)
+	fs.StringVar(&addr, "addr", ":8080", "address to listen on")
+	fs.UintVar(&taxRate, "tax-rate", 0, "tax of the invoices in basis points, 1900 is 19%")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.store.Metrics())
+	mux.Handle("/", api.NewServer(
+		product.NewService(a.store.Product()),
+		invoiceService(a, taxRate),
+	))
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(a.stdout, "API escuchando en %s\n", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
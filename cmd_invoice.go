@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// dateLayout of the date flags
+const dateLayout = "2006-01-02"
+
+// itemsFlag collects the items of an invoice, every -item is
+// product_id[:quantity[:discount]] and the discount is in the minor unit
+// of the currency of the invoice
+type itemsFlag invoiceitem.Models
+
+// String implements flag.Value
+func (f *itemsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	items := make([]string, 0, len(*f))
+	for _, item := range *f {
+		items = append(items, fmt.Sprintf("%d:%d:%d", item.ProductID, item.Quantity, item.Discount.Amount))
+	}
+	return strings.Join(items, ",")
+}
+
+// Set implements flag.Value
+func (f *itemsFlag) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return fmt.Errorf("item inválido %q, se espera product_id[:quantity[:discount]]", s)
+	}
+
+	values := []uint64{0, 1, 0}
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 0)
+		if err != nil {
+			return fmt.Errorf("item inválido %q: %w", s, err)
+		}
+		values[i] = v
+	}
+	if values[0] == 0 {
+		return fmt.Errorf("item inválido %q, falta el producto", s)
+	}
+
+	*f = append(*f, &invoiceitem.Model{
+		ProductID: uint(values[0]),
+		Quantity:  uint(values[1]),
+		Discount:  money.Money{Amount: int64(values[2])},
+	})
+	return nil
+}
+
+// dateFlag defines a flag of a date in the local time zone
+func dateFlag(fs *flag.FlagSet, dst *time.Time, name, usage string) {
+	fs.Func(name, usage+" ("+dateLayout+")", func(s string) error {
+		t, err := time.ParseInLocation(dateLayout, s, time.Local)
+		if err != nil {
+			return err
+		}
+		*dst = t
+		return nil
+	})
+}
+
+func invoiceService(a *app, taxRate uint) *invoice.Service {
+	return invoice.NewService(
+		a.store.Invoice(),
+		invoice.WithProducts(a.store.Product()),
+		invoice.WithTaxRate(taxRate),
+	)
+}
+
+func invoiceCreate(ctx context.Context, a *app, args []string) error {
+	h := &invoiceheader.Model{}
+	items := itemsFlag{}
+	var taxRate uint
+	fs := newFlagSet("invoice create", a.stderr)
+	fs.StringVar(&h.Client, "client", "", "client of the invoice")
+	fs.StringVar((*string)(&h.Status), "status", string(invoiceheader.StatusDraft), "initial status: draft or issued")
+	fs.Var(&items, "item", "item as product_id[:quantity[:discount]] with the discount in cents, it can be repeated")
+	fs.UintVar(&taxRate, "tax-rate", 0, "tax in basis points, 1900 is 19%")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if h.Client == "" {
+		return usagef("invoice create: -client es obligatorio")
+	}
+
+	service := invoiceService(a, taxRate)
+	m := &invoice.Model{Header: h, Items: invoiceitem.Models(items)}
+	if err := service.CreateContext(ctx, m); err != nil {
+		return err
+	}
+
+	// read it again to print the names of the products
+	m, err := service.GetByIDContext(ctx, m.Header.ID)
+	if err != nil {
+		return err
+	}
+
+	return printInvoice(a.stdout, m)
+}
+
+func invoiceShow(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("invoice show", a.stderr)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	m, err := invoiceService(a, 0).GetByIDContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printInvoice(a.stdout, m)
+}
+
+func invoiceList(ctx context.Context, a *app, args []string) error {
+	f := invoiceheader.Filter{}
+	fs := newFlagSet("invoice list", a.stderr)
+	fs.StringVar(&f.Client, "client", "", "part of the name of the client")
+	dateFlag(fs, &f.From, "from", "first day")
+	dateFlag(fs, &f.To, "to", "day after the last one")
+	fs.StringVar((*string)(&f.Status), "status", "", "status: draft, issued, paid or cancelled")
+	fs.IntVar(&f.Limit, "limit", invoiceheader.DefaultLimit, "max number of invoices")
+	fs.IntVar(&f.Offset, "offset", 0, "number of invoices to skip")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	ms, err := invoiceService(a, 0).ListContext(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tSTATUS\tKIND\tITEMS\tSUBTOTAL\tTAX\tTOTAL\tCREATED_AT")
+	for _, m := range ms {
+		h := m.Header
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			h.ID, h.Client, h.Status, h.Kind, len(m.Items),
+			h.Subtotal, h.Tax, h.Total, h.CreateAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func invoiceIssue(ctx context.Context, a *app, args []string) error {
+	return invoiceChangeStatus(ctx, a, "invoice issue", args, invoiceService(a, 0).IssueContext)
+}
+
+func invoicePay(ctx context.Context, a *app, args []string) error {
+	return invoiceChangeStatus(ctx, a, "invoice pay", args, invoiceService(a, 0).PayContext)
+}
+
+func invoiceChangeStatus(ctx context.Context, a *app, name string, args []string, change func(context.Context, uint, string) error) error {
+	var reason string
+	fs := newFlagSet(name, a.stderr)
+	fs.StringVar(&reason, "reason", "", "reason of the change")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return change(ctx, id, reason)
+}
+
+func invoiceCancel(ctx context.Context, a *app, args []string) error {
+	var reason string
+	fs := newFlagSet("invoice cancel", a.stderr)
+	fs.StringVar(&reason, "reason", "", "reason of the cancellation")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	creditNote, err := invoiceService(a, 0).CancelContext(ctx, id, reason)
+	if err != nil {
+		return err
+	}
+	if creditNote == nil {
+		return nil
+	}
+
+	return printInvoice(a.stdout, creditNote)
+}
+
+func invoiceHistory(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("invoice history", a.stderr)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	cs, err := invoiceService(a, 0).HistoryContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tREASON\tCREATED_AT")
+	for _, c := range cs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.From, c.To, c.Reason, c.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func printInvoice(out io.Writer, m *invoice.Model) error {
+	h := m.Header
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", h.ID)
+	fmt.Fprintf(w, "Client:\t%s\n", h.Client)
+	fmt.Fprintf(w, "Status:\t%s\n", h.Status)
+	fmt.Fprintf(w, "Kind:\t%s\n", h.Kind)
+	if h.ReferenceID != 0 {
+		fmt.Fprintf(w, "Reference:\t%d\n", h.ReferenceID)
+	}
+	fmt.Fprintf(w, "Created at:\t%s\n", h.CreateAt.Format(time.RFC3339))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\nPRODUCT\tNAME\tQUANTITY\tUNIT_PRICE\tDISCOUNT\tTOTAL\t")
+	for _, item := range m.Items {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t\n",
+			item.ProductID, item.ProductName, item.Quantity, item.UnitPrice, item.Discount, item.Total)
+	}
+	fmt.Fprintf(w, "\t\t\t\tSubtotal\t%s\t\n", h.Subtotal)
+	fmt.Fprintf(w, "\t\t\t\tTax\t%s\t\n", h.Tax)
+	fmt.Fprintf(w, "\t\t\t\tTotal\t%s\t\n", h.Total)
+	return w.Flush()
+}
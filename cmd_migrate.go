@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func migrateUp(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("migrate up", a.stderr)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	m, err := a.store.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := m.Up(ctx); err != nil {
+		return err
+	}
+	if err := a.store.VerifySchema(ctx); err != nil {
+		return err
+	}
+	return printVersion(ctx, a)
+}
+
+func migrateDown(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("migrate down", a.stderr)
+	n := fs.Int("n", 1, "number of migrations to revert")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *n < 1 {
+		return usagef("migrate down: -n debe ser mayor a cero")
+	}
+
+	m, err := a.store.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := m.Down(ctx, *n); err != nil {
+		return err
+	}
+	return printVersion(ctx, a)
+}
+
+func migrateGoto(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("migrate goto", a.stderr)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usagef("migrate goto: se espera la versión")
+	}
+	version, err := strconv.ParseUint(fs.Arg(0), 10, 0)
+	if err != nil {
+		return usagef("versión inválida: %q", fs.Arg(0))
+	}
+
+	m, err := a.store.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := m.Goto(ctx, uint(version)); err != nil {
+		return err
+	}
+	return printVersion(ctx, a)
+}
+
+func migrateStatus(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("migrate status", a.stderr)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	m, err := a.store.Migrator()
+	if err != nil {
+		return err
+	}
+	ss, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED_AT\tMODIFIED")
+	for _, s := range ss {
+		appliedAt := "-"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\n", s.Version, s.Name, appliedAt, s.Modified)
+	}
+	return w.Flush()
+}
+
+func printVersion(ctx context.Context, a *app) error {
+	m, err := a.store.Migrator()
+	if err != nil {
+		return err
+	}
+	v, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Versión del esquema: %d\n", v)
+	return nil
+}
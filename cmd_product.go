@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+)
+
+// productFlags defines the flags of the fields of a product, the price is
+// left in price until it is parsed with parseMoney
+func productFlags(fs *flag.FlagSet, m *product.Model, price *string) {
+	fs.StringVar(&m.Name, "name", m.Name, "name of the product")
+	fs.StringVar(&m.Observations, "observations", m.Observations, "observations of the product")
+	fs.StringVar(price, "price", "0", "price of the product, e.g. 12.50")
+	fs.StringVar((*string)(&m.Price.Currency), "currency", string(money.DefaultCurrency), "ISO 4217 currency of the price")
+}
+
+// parseMoney parses the value s of the flag name in the currency c
+func parseMoney(name, s string, c money.Currency) (money.Money, error) {
+	m, err := money.Parse(s, c)
+	if err != nil {
+		return m, usagef("-%s: %v", name, err)
+	}
+	return m, nil
+}
+
+// parseOptionalMoney is parseMoney of a flag that can be empty, it returns
+// nil then
+func parseOptionalMoney(name, s string, c money.Currency) (*money.Money, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m, err := parseMoney(name, s, c)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func productCreate(ctx context.Context, a *app, args []string) error {
+	m := &product.Model{}
+	var price string
+	fs := newFlagSet("product create", a.stderr)
+	productFlags(fs, m, &price)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var err error
+	if m.Price, err = parseMoney("price", price, m.Price.Currency); err != nil {
+		return err
+	}
+
+	if err := product.NewService(a.store.Product()).CreateContext(ctx, m); err != nil {
+		return err
+	}
+
+	fmt.Fprint(a.stdout, product.Models{m})
+	return nil
+}
+
+// productList prints a page of products, the cursor of the next one goes
+// to stderr so stdout only has the list
+func productList(ctx context.Context, a *app, args []string) error {
+	o := product.ListOptions{}
+	var minPrice, maxPrice, currency, after string
+	fs := newFlagSet("product list", a.stderr)
+	fs.StringVar(&o.Name, "name", "", "part of the name of the product")
+	fs.StringVar(&minPrice, "min-price", "", "min price, e.g. 10.50")
+	fs.StringVar(&maxPrice, "max-price", "", "max price, e.g. 99.99")
+	fs.StringVar(&currency, "currency", string(money.DefaultCurrency), "currency of -min-price and -max-price")
+	fs.StringVar((*string)(&o.Sort), "sort", string(product.SortID), "sort by id, name, price or created_at")
+	fs.BoolVar(&o.Desc, "desc", false, "descending order")
+	fs.IntVar(&o.Limit, "limit", product.DefaultLimit, "max number of products")
+	fs.IntVar(&o.Offset, "offset", 0, "number of products to skip")
+	fs.StringVar(&after, "after", "", "cursor of the next page printed by the previous one")
+	deleted := deletedFlag(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *deleted {
+		ctx = product.WithDeleted(ctx)
+	}
+
+	var err error
+	if o.MinPrice, err = parseOptionalMoney("min-price", minPrice, money.Currency(currency)); err != nil {
+		return err
+	}
+	if o.MaxPrice, err = parseOptionalMoney("max-price", maxPrice, money.Currency(currency)); err != nil {
+		return err
+	}
+	if after != "" {
+		if o.After, err = product.ParseCursor(after); err != nil {
+			return err
+		}
+	}
+
+	ms, err := product.NewService(a.store.Product()).ListContext(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(a.stdout, ms)
+	if next := o.Next(ms); next != nil {
+		fmt.Fprintf(a.stderr, "siguiente página: -after %s\n", next)
+	}
+	return nil
+}
+
+// productExport writes every product as a line of JSON, the products are
+// streamed from the db so the catalogue is never loaded at once
+func productExport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("product export", a.stderr)
+	deleted := deletedFlag(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *deleted {
+		ctx = product.WithDeleted(ctx)
+	}
+
+	enc := json.NewEncoder(a.stdout)
+	return product.NewService(a.store.Product()).EachContext(ctx, func(m *product.Model) error {
+		return enc.Encode(m)
+	})
+}
+
+func productGet(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("product get", a.stderr)
+	deleted := deletedFlag(fs)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+	if *deleted {
+		ctx = product.WithDeleted(ctx)
+	}
+
+	m, err := product.NewService(a.store.Product()).GetByIDContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(a.stdout, product.Models{m})
+	return nil
+}
+
+// productUpdate changes only the fields given as flags
+func productUpdate(ctx context.Context, a *app, args []string) error {
+	changes := &product.Model{}
+	var price string
+	fs := newFlagSet("product update", a.stderr)
+	productFlags(fs, changes, &price)
+	fs.UintVar(&changes.Version, "version", 0, "version of the product that is changed, it fails if the product changed since then")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	patch := product.Patch{Version: changes.Version}
+	var priceSet, currencySet bool
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			patch.Name = &changes.Name
+		case "observations":
+			patch.Observations = &changes.Observations
+		case "price":
+			priceSet = true
+		case "currency":
+			currencySet = true
+		}
+	})
+
+	service := product.NewService(a.store.Product())
+
+	// without -currency the new price is in the current currency, without
+	// -price the current amount is kept
+	if priceSet || currencySet {
+		current, err := service.GetByIDContext(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		p := current.Price
+		if currencySet {
+			p.Currency = changes.Price.Currency
+		}
+		if priceSet {
+			if p, err = parseMoney("price", price, p.Currency); err != nil {
+				return err
+			}
+		}
+		patch.Price = &p
+	}
+
+	m, err := service.PatchContext(ctx, id, patch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(a.stdout, product.Models{m})
+	return nil
+}
+
+func productDelete(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("product delete", a.stderr)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return product.NewService(a.store.Product()).DeleteContext(ctx, id)
+}
+
+func productRestore(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("product restore", a.stderr)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	service := product.NewService(a.store.Product())
+	if err := service.RestoreContext(ctx, id); err != nil {
+		return err
+	}
+
+	m, err := service.GetByIDContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(a.stdout, product.Models{m})
+	return nil
+}
+
+// deletedFlag defines the flag that includes the deleted products
+func deletedFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("deleted", false, "include the deleted products")
+}
@@ -1,28 +1,230 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/eltaljohn/go-db/pkg/product"
 	"github.com/eltaljohn/go-db/pkg/storage"
-	"log"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func main() {
+// exit codes of go-db
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+// errFlags is returned when the flag package already reported a wrong flag
+var errFlags = errors.New("flags inválidos")
+
+// usageError is returned when the arguments of a command are wrong
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
 
-	driver := storage.Postgres
-	storage.New(driver)
+func usagef(format string, a ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, a...)}
+}
+
+// app is what the commands use to work
+type app struct {
+	store  *storage.Store
+	stdout io.Writer
+	stderr io.Writer
+}
 
-	myStorage, err := storage.DAOProduct(driver)
+// commands by name and subcommand
+var commands = map[string]map[string]func(context.Context, *app, []string) error{
+	"api": {
+		"serve": apiServe,
+	},
+	"migrate": {
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+		"goto":   migrateGoto,
+	},
+	"product": {
+		"create":  productCreate,
+		"list":    productList,
+		"get":     productGet,
+		"update":  productUpdate,
+		"delete":  productDelete,
+		"export":  productExport,
+		"restore": productRestore,
+	},
+	"invoice": {
+		"create":  invoiceCreate,
+		"show":    invoiceShow,
+		"list":    invoiceList,
+		"issue":   invoiceIssue,
+		"pay":     invoicePay,
+		"cancel":  invoiceCancel,
+		"history": invoiceHistory,
+	},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes go-db with args and returns the exit code
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	c, args, err := parseConfig(args, stderr)
 	if err != nil {
-		log.Fatalf("DAOProduct:  %v", err)
+		return exitCode(err, stderr)
 	}
 
-	serviceProduct := product.NewService(myStorage)
+	if len(args) < 2 {
+		usage(stderr)
+		return exitUsage
+	}
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "go-db: comando desconocido %q\n", strings.Join(args[:2], " "))
+		usage(stderr)
+		return exitUsage
+	}
 
-	ms, err := serviceProduct.GetAll()
+	store, err := storage.Open(c)
 	if err != nil {
-		log.Fatalf("Product.GetAll %v", err)
+		return exitCode(err, stderr)
+	}
+	defer store.Close()
+
+	return exitCode(cmd(ctx, &app{store, stdout, stderr}, args[2:]), stderr)
+}
+
+// parseConfig reads the config of the driver chosen with -driver from the
+// environment and the .env file, the flags override it. It returns the
+// arguments after the flags
+func parseConfig(args []string, stderr io.Writer) (storage.Config, []string, error) {
+	c := storage.Config{Driver: storage.Postgres}
+	fs := newFlagSet("go-db", stderr)
+	c.RegisterFlags(fs)
+	fs.Usage = func() {
+		usage(stderr)
+		fmt.Fprintln(stderr, "\nflags:")
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return c, nil, err
+	}
+
+	if err := storage.LoadEnvFile(); err != nil {
+		return c, nil, err
+	}
+	env, err := storage.ConfigFromEnv(c.Driver)
+	var ce *storage.ConfigError
+	if err != nil && !(errors.As(err, &ce) && len(ce.Invalid) == 0) {
+		return c, nil, err
+	}
+
+	// the missing fields can come from the flags, Open validates the result
+	fs = newFlagSet("go-db", stderr)
+	env.RegisterFlags(fs)
+	if err := parse(fs, args); err != nil {
+		return c, nil, err
 	}
 
-	fmt.Println(ms)
+	return env, fs.Args(), nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: go-db [flags] <command> <subcommand> [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		subs := make([]string, 0, len(commands[name]))
+		for sub := range commands[name] {
+			subs = append(subs, sub)
+		}
+		sort.Strings(subs)
+		fmt.Fprintf(w, "  %-8s %s\n", name, strings.Join(subs, "|"))
+	}
+}
+
+// exitCode reports err in stderr and returns its exit code
+func exitCode(err error, stderr io.Writer) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errFlags):
+		return exitUsage
+	}
+
+	fmt.Fprintf(stderr, "go-db: %v\n", err)
+
+	var ue *usageError
+	switch {
+	case errors.As(err, &ue), errors.Is(err, product.ErrValidation),
+		errors.Is(err, product.ErrInvalidListOptions), errors.Is(err, product.ErrEmptyPatch):
+		return exitUsage
+	case errors.Is(err, product.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return exitNotFound
+	default:
+		return exitError
+	}
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parse parses the flags of fs, the errors are already reported by fs
+func parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errFlags
+	}
+	return err
+}
+
+// parseWithID parses the flags of fs and the ID that must follow them,
+// the ID can also be the first argument
+func parseWithID(fs *flag.FlagSet, args []string) (uint, error) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(append([]string{}, args[1:]...), args[0])
+	}
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+
+	if fs.NArg() != 1 {
+		return 0, usagef("%s: se espera un ID", fs.Name())
+	}
+	return parseID(fs.Arg(0))
+}
+
+func parseID(s string) (uint, error) {
+	id, err := strconv.ParseUint(s, 10, 0)
+	if err != nil || id == 0 {
+		return 0, usagef("ID inválido: %q", s)
+	}
+	return uint(id), nil
 }
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize of the requests
+const maxBodySize = 1 << 20
+
+var (
+	ErrInvalidID      = errors.New("El ID no es válido")
+	ErrInvalidBody    = errors.New("El cuerpo de la petición no es válido")
+	ErrInvalidIfMatch = errors.New("If-Match inválido")
+	// ErrMissingIfMatch is returned when a PUT or PATCH of a product has no
+	// If-Match header
+	ErrMissingIfMatch = errors.New("Falta el encabezado If-Match con el ETag del producto")
+)
+
+// Server exposes the product and invoice services as a JSON API:
+//
+//	GET    /products?name=&min_price=&max_price=&currency=&sort=&desc=&limit=&offset=&after=&deleted=
+//	POST   /products
+//	GET    /products/{id}?deleted=
+//	PUT    /products/{id} with If-Match
+//	PATCH  /products/{id} with If-Match
+//	DELETE /products/{id}
+//	POST   /products/{id}/restore
+//	GET    /invoices
+//	POST   /invoices
+//	GET    /invoices/{id}
+type Server struct {
+	products *product.Service
+	invoices *invoice.Service
+}
+
+// NewServer returns a new pointer of Server
+func NewServer(p *product.Service, i *invoice.Service) *Server {
+	return &Server{p, i}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource, rawID, action, ok := splitPath(r.URL.Path)
+	if !ok || (resource != "products" && resource != "invoices") {
+		writeError(w, http.StatusNotFound, errors.New("recurso no encontrado"))
+		return
+	}
+
+	if rawID == "" {
+		switch resource {
+		case "products":
+			route(w, r, map[string]http.HandlerFunc{
+				http.MethodGet:  s.listProducts,
+				http.MethodPost: s.createProduct,
+			})
+		case "invoices":
+			route(w, r, map[string]http.HandlerFunc{
+				http.MethodGet:  s.listInvoices,
+				http.MethodPost: s.createInvoice,
+			})
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(rawID, 10, 0)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrInvalidID, rawID))
+		return
+	}
+
+	switch {
+	case resource == "products" && action == "restore":
+		route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: withID(uint(id), s.restoreProduct),
+		})
+	case action != "":
+		writeError(w, http.StatusNotFound, errors.New("recurso no encontrado"))
+	case resource == "products":
+		route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    withID(uint(id), s.getProduct),
+			http.MethodPut:    withID(uint(id), s.updateProduct),
+			http.MethodPatch:  withID(uint(id), s.patchProduct),
+			http.MethodDelete: withID(uint(id), s.deleteProduct),
+		})
+	case resource == "invoices":
+		route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: withID(uint(id), s.getInvoice),
+		})
+	}
+}
+
+// route calls the handler of the method of the request
+func route(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	h, ok := handlers[r.Method]
+	if !ok {
+		allow := make([]string, 0, len(handlers))
+		for m := range handlers {
+			allow = append(allow, m)
+		}
+		sort.Strings(allow)
+
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, http.StatusMethodNotAllowed, errors.New("método no permitido"))
+		return
+	}
+	h(w, r)
+}
+
+func withID(id uint, h func(http.ResponseWriter, *http.Request, uint)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, id)
+	}
+}
+
+// splitPath returns the resource, the id and the action of paths like
+// /products, /products/{id} and /products/{id}/restore
+func splitPath(path string) (resource, id, action string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch len(parts) {
+	case 1:
+		return parts[0], "", "", parts[0] != ""
+	case 2:
+		return parts[0], parts[1], "", parts[1] != ""
+	case 3:
+		return parts[0], parts[1], parts[2], parts[1] != "" && parts[2] != ""
+	default:
+		return "", "", "", false
+	}
+}
+
+// readJSON decodes the body of the request in v
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// errorResponse is the body of every error, Fields lists the fields that
+// failed the validation
+type errorResponse struct {
+	Error  string               `json:"error"`
+	Fields []product.FieldError `json:"fields,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	res := errorResponse{Error: err.Error()}
+	var ve *product.ValidationError
+	if errors.As(err, &ve) {
+		res.Fields = ve.Fields
+	}
+	writeJSON(w, status, res)
+}
+
+// statusCode maps the errors of the services to http status codes
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, product.ErrNotFound),
+		errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, product.ErrStaleVersion):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrMissingIfMatch):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, product.ErrConflict),
+		errors.Is(err, product.ErrForeignKey):
+		return http.StatusConflict
+	case errors.Is(err, product.ErrValidation),
+		errors.Is(err, product.ErrIDNotFound),
+		errors.Is(err, product.ErrInvalidListOptions),
+		errors.Is(err, product.ErrEmptyPatch),
+		errors.Is(err, ErrInvalidID),
+		errors.Is(err, ErrInvalidBody),
+		errors.Is(err, ErrInvalidIfMatch),
+		errors.Is(err, invoice.ErrWithoutHeader),
+		errors.Is(err, invoice.ErrInvalidDiscount),
+		errors.Is(err, invoice.ErrInvalidStatus),
+		errors.Is(err, money.ErrCurrencyMismatch),
+		errors.Is(err, money.ErrUnknownCurrency),
+		errors.Is(err, money.ErrInvalidAmount),
+		errors.Is(err, money.ErrOverflow):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeServiceError writes err with the status code of statusCode, the
+// message of internal errors is not exposed
+func writeServiceError(w http.ResponseWriter, err error) {
+	status := statusCode(err)
+	if status == http.StatusInternalServerError {
+		err = errors.New(http.StatusText(status))
+	}
+	writeError(w, status, err)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server over a memory store with the product 1,
+// "lápiz" of 10.00 USD, the draft invoice 1 of it and the product 2,
+// "borrador" of 2.50 USD, that is not in any invoice
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ctx := context.Background()
+
+	s, err := storage.Open(storage.Config{Driver: storage.Memory})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	products := product.NewService(s.Product())
+	invoices := invoice.NewService(s.Invoice(), invoice.WithProducts(s.Product()))
+
+	for _, p := range []*product.Model{{Name: "lápiz", Price: money.New(1000, "USD")}, {Name: "borrador", Price: money.New(250, "USD")}} {
+		if err := products.CreateContext(ctx, p); err != nil {
+			t.Fatalf("Create product: %v", err)
+		}
+	}
+	m := &invoice.Model{}
+	if err := json.Unmarshal([]byte(`{"header":{"client":"Alexys"},"items":[{"product_id":1,"quantity":2}]}`), m); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoices.CreateContext(ctx, m); err != nil {
+		t.Fatalf("Create invoice: %v", err)
+	}
+
+	ts := httptest.NewServer(NewServer(products, invoices))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		ifMatch string
+		body    string
+		// setup runs before the request
+		setup      func(*testing.T, *httptest.Server)
+		wantStatus int
+		wantETag   string
+		// wantBody is a substring of the response
+		wantBody string
+	}{
+		{name: "list products", method: http.MethodGet, path: "/products", wantStatus: http.StatusOK, wantBody: `"name":"lápiz"`},
+		{name: "get product", method: http.MethodGet, path: "/products/1", wantStatus: http.StatusOK, wantETag: `"1"`, wantBody: `"id":1`},
+		{name: "get missing product", method: http.MethodGet, path: "/products/9", wantStatus: http.StatusNotFound},
+		{name: "invalid id", method: http.MethodGet, path: "/products/x", wantStatus: http.StatusBadRequest},
+		{name: "unknown resource", method: http.MethodGet, path: "/clients", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPut, path: "/products", wantStatus: http.StatusMethodNotAllowed},
+		{
+			name:       "create product",
+			method:     http.MethodPost,
+			path:       "/products",
+			body:       `{"name":"regla","price":{"amount":300,"currency":"USD"}}`,
+			wantStatus: http.StatusCreated,
+			wantETag:   `"1"`,
+			wantBody:   `"id":3`,
+		},
+		{
+			name:       "create invalid product",
+			method:     http.MethodPost,
+			path:       "/products",
+			body:       `{"name":"","price":{"amount":-1,"currency":"USD"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"fields":[{"field":"name"`,
+		},
+		{
+			name:       "create product with an unknown currency",
+			method:     http.MethodPost,
+			path:       "/products",
+			body:       `{"name":"regla","price":{"amount":300,"currency":"XXX"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `"field":"price"`,
+		},
+		{name: "create unknown field", method: http.MethodPost, path: "/products", body: `{"nombre":"x"}`, wantStatus: http.StatusBadRequest},
+		{
+			name:       "update",
+			method:     http.MethodPut,
+			path:       "/products/1",
+			ifMatch:    `"1"`,
+			body:       `{"name":"lápiz rojo","price":{"amount":1200,"currency":"USD"}}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"2"`,
+			wantBody:   `"name":"lápiz rojo"`,
+		},
+		{
+			name:       "update any version",
+			method:     http.MethodPut,
+			path:       "/products/1",
+			ifMatch:    "*",
+			body:       `{"name":"lápiz rojo","price":{"amount":1200,"currency":"USD"}}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"2"`,
+		},
+		{
+			name:       "update without If-Match",
+			method:     http.MethodPut,
+			path:       "/products/1",
+			body:       `{"name":"lápiz rojo","price":{"amount":1200,"currency":"USD"}}`,
+			wantStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:       "update stale",
+			method:     http.MethodPut,
+			path:       "/products/1",
+			ifMatch:    `"7"`,
+			body:       `{"name":"lápiz rojo","price":{"amount":1200,"currency":"USD"}}`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "update invalid If-Match",
+			method:     http.MethodPut,
+			path:       "/products/1",
+			ifMatch:    "uno",
+			body:       `{"name":"lápiz rojo","price":{"amount":1200,"currency":"USD"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "patch",
+			method:     http.MethodPatch,
+			path:       "/products/1",
+			ifMatch:    `"1"`,
+			body:       `{"name":"lápiz azul"}`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"2"`,
+			wantBody:   `"price":{"amount":1000,"currency":"USD"}`,
+		},
+		{name: "patch any version", method: http.MethodPatch, path: "/products/1", ifMatch: "*", body: `{"name":"lápiz azul"}`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "patch without If-Match", method: http.MethodPatch, path: "/products/1", body: `{"name":"lápiz azul"}`, wantStatus: http.StatusPreconditionRequired},
+		{name: "patch stale", method: http.MethodPatch, path: "/products/1", ifMatch: `"3"`, body: `{"name":"lápiz azul"}`, wantStatus: http.StatusPreconditionFailed},
+		{name: "patch empty", method: http.MethodPatch, path: "/products/1", ifMatch: `"1"`, body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "patch invalid", method: http.MethodPatch, path: "/products/1", ifMatch: `"1"`, body: `{"name":""}`, wantStatus: http.StatusBadRequest, wantBody: `"field":"name"`},
+		{name: "patch missing", method: http.MethodPatch, path: "/products/9", ifMatch: "*", body: `{"name":"x"}`, wantStatus: http.StatusNotFound},
+		{name: "update missing", method: http.MethodPut, path: "/products/9", ifMatch: "*", body: `{"name":"x","price":{"amount":1,"currency":"USD"}}`, wantStatus: http.StatusNotFound},
+		{name: "delete", method: http.MethodDelete, path: "/products/2", wantStatus: http.StatusNoContent},
+		{name: "delete missing", method: http.MethodDelete, path: "/products/9", wantStatus: http.StatusNotFound},
+		{name: "delete used by an invoice", method: http.MethodDelete, path: "/products/1", wantStatus: http.StatusNoContent},
+		{
+			name:       "restore",
+			method:     http.MethodPost,
+			path:       "/products/1/restore",
+			setup:      func(t *testing.T, ts *httptest.Server) { do(t, ts, http.MethodDelete, "/products/1", "", "") },
+			wantStatus: http.StatusOK,
+			wantETag:   `"3"`,
+			wantBody:   `"name":"lápiz"`,
+		},
+		{name: "restore active", method: http.MethodPost, path: "/products/1/restore", wantStatus: http.StatusNotFound},
+		{
+			name:       "get deleted",
+			method:     http.MethodGet,
+			path:       "/products/1?deleted=true",
+			setup:      func(t *testing.T, ts *httptest.Server) { do(t, ts, http.MethodDelete, "/products/1", "", "") },
+			wantStatus: http.StatusOK,
+			wantBody:   `"deleted_at":"`,
+		},
+		{
+			name:       "get deleted without the flag",
+			method:     http.MethodGet,
+			path:       "/products/1",
+			setup:      func(t *testing.T, ts *httptest.Server) { do(t, ts, http.MethodDelete, "/products/1", "", "") },
+			wantStatus: http.StatusNotFound,
+		},
+		{name: "list invoices", method: http.MethodGet, path: "/invoices", wantStatus: http.StatusOK, wantBody: `"product_name":"lápiz"`},
+		{name: "list invoices by status", method: http.MethodGet, path: "/invoices?status=paid", wantStatus: http.StatusOK, wantBody: `[]`},
+		{name: "list invoices of today", method: http.MethodGet, path: "/invoices?to=" + time.Now().Format("2006-01-02"), wantStatus: http.StatusOK, wantBody: `"client":"Alexys"`},
+		{name: "list invoices invalid date", method: http.MethodGet, path: "/invoices?from=ayer", wantStatus: http.StatusBadRequest},
+		{name: "get invoice", method: http.MethodGet, path: "/invoices/1", wantStatus: http.StatusOK, wantBody: `"total":{"amount":2000,"currency":"USD"}`},
+		{name: "get missing invoice", method: http.MethodGet, path: "/invoices/9", wantStatus: http.StatusNotFound},
+		{
+			name:       "create invoice",
+			method:     http.MethodPost,
+			path:       "/invoices",
+			body:       `{"header":{"client":"Ana"},"items":[{"product_id":1,"quantity":3}]}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `"product_name":"lápiz"`,
+		},
+		{name: "create invoice without header", method: http.MethodPost, path: "/invoices", body: `{"items":[]}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if tt.setup != nil {
+				tt.setup(t, ts)
+			}
+
+			res, body := do(t, ts, tt.method, tt.path, tt.ifMatch, tt.body)
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantETag != "" && res.Header.Get("ETag") != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", res.Header.Get("ETag"), tt.wantETag)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+			if res.StatusCode >= 400 && !strings.Contains(body, `"error"`) {
+				t.Errorf("error without message: %s", body)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.Local)
+	rfc := time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		s       string
+		end     bool
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "", want: time.Time{}},
+		{s: "2022-03-01", want: day},
+		{s: "2022-03-01", end: true, want: day.AddDate(0, 0, 1)},
+		{s: "2022-03-01T10:30:00Z", end: true, want: rfc},
+		{s: "01/03/2022", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTime(tt.s, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTime(%q, %v): err = %v", tt.s, tt.end, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q, %v) = %v, want %v", tt.s, tt.end, got, tt.want)
+		}
+	}
+}
+
+// do sends a request to ts and returns the response and its body
+func do(t *testing.T, ts *httptest.Server, method, path, ifMatch, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return res, string(b)
+}
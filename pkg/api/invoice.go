@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// listInvoices reads the filter from the query: client, from and to (RFC
+// 3339 or 2006-01-02, a date in to includes that day), status, limit and
+// offset
+func (s *Server) listInvoices(w http.ResponseWriter, r *http.Request) {
+	f, err := invoiceFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ms, err := s.invoices.ListContext(r.Context(), f)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ms)
+}
+
+func (s *Server) createInvoice(w http.ResponseWriter, r *http.Request) {
+	m := &invoice.Model{}
+	if err := readJSON(w, r, m); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	err := s.invoices.CreateContext(r.Context(), m)
+	if errors.Is(err, product.ErrNotFound) {
+		// the product of an item, not the invoice, does not exist
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	// read it again to answer with the names of the products
+	saved, err := s.invoices.GetByIDContext(r.Context(), m.Header.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, saved)
+}
+
+func (s *Server) getInvoice(w http.ResponseWriter, r *http.Request, id uint) {
+	m, err := s.invoices.GetByIDContext(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func invoiceFilter(r *http.Request) (invoiceheader.Filter, error) {
+	q := r.URL.Query()
+	f := invoiceheader.Filter{
+		Client: q.Get("client"),
+		Status: invoiceheader.Status(q.Get("status")),
+	}
+
+	var err error
+	if f.From, err = parseTime(q.Get("from"), false); err != nil {
+		return f, fmt.Errorf("from: %w", err)
+	}
+	if f.To, err = parseTime(q.Get("to"), true); err != nil {
+		return f, fmt.Errorf("to: %w", err)
+	}
+	if f.Limit, err = parseInt(q.Get("limit")); err != nil {
+		return f, fmt.Errorf("limit: %w", err)
+	}
+	if f.Offset, err = parseInt(q.Get("offset")); err != nil {
+		return f, fmt.Errorf("offset: %w", err)
+	}
+
+	return f, nil
+}
+
+// parseTime parses s as RFC 3339 or as a local date. Filter.To is
+// exclusive, so a date used as the end of a range is moved to the next day
+// to include the whole day
+func parseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func parseInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("número inválido: %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listProducts reads the options from the query: name, min_price and
+// max_price (decimals in currency, USD by default), sort, desc, limit,
+// offset, after and deleted. The Link header has the next page when there
+// is one
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, err := productContext(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	o, err := productListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ms, err := s.products.ListContext(ctx, o)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if next := o.Next(ms); next != nil {
+		q := r.URL.Query()
+		q.Set("after", next.String())
+		q.Del("offset")
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, q.Encode()))
+	}
+	writeJSON(w, http.StatusOK, ms)
+}
+
+func (s *Server) createProduct(w http.ResponseWriter, r *http.Request) {
+	m := &product.Model{}
+	if err := readJSON(w, r, m); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	m.ID = 0
+
+	if err := s.products.CreateContext(r.Context(), m); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeProduct(w, http.StatusCreated, m)
+}
+
+// getProduct finds the deleted products too with ?deleted=true
+func (s *Server) getProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	ctx, err := productContext(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	m, err := s.products.GetByIDContext(ctx, id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeProduct(w, http.StatusOK, m)
+}
+
+// updateProduct replaces the product, the id of the path wins over the
+// one of the body. The If-Match header, the ETag of the product, is
+// required and wins over the version of the body: without it the response
+// is 428 and if it is stale 412. The response is the product as it was
+// saved
+func (s *Server) updateProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	version, err := ifMatch(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	m := &product.Model{}
+	if err := readJSON(w, r, m); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	m.ID = id
+	m.Version = version
+
+	if err := s.products.UpdateContext(r.Context(), m); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	s.getProduct(w, r, id)
+}
+
+// patchProduct changes the fields of the body, the others are left as
+// they are. The version works like in updateProduct
+func (s *Server) patchProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	version, err := ifMatch(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	p := product.Patch{}
+	if err := readJSON(w, r, &p); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	p.Version = version
+
+	m, err := s.products.PatchContext(r.Context(), id, p)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeProduct(w, http.StatusOK, m)
+}
+
+func (s *Server) deleteProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	if err := s.products.DeleteContext(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) restoreProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	if err := s.products.RestoreContext(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	s.getProduct(w, r, id)
+}
+
+// writeProduct writes m with its version as ETag
+func writeProduct(w http.ResponseWriter, status int, m *product.Model) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatUint(uint64(m.Version), 10)))
+	writeJSON(w, status, m)
+}
+
+// ifMatch returns the version of the If-Match header of r, it fails with
+// ErrMissingIfMatch if there is none so a client can not overwrite a
+// product it did not read. * matches any version
+func ifMatch(r *http.Request) (uint, error) {
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		return 0, ErrMissingIfMatch
+	}
+	return parseETag(match)
+}
+
+// parseETag returns the version of an ETag of writeProduct, 0 for * that
+// matches any version
+func parseETag(s string) (uint, error) {
+	if s == "*" {
+		return 0, nil
+	}
+
+	v, err := strconv.Unquote(strings.TrimPrefix(s, "W/"))
+	if err == nil {
+		var version uint64
+		if version, err = strconv.ParseUint(v, 10, 0); err == nil && version > 0 {
+			return uint(version), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidIfMatch, s)
+}
+
+// productContext returns the context of the request, with the deleted
+// products when the query has deleted=true
+func productContext(r *http.Request) (context.Context, error) {
+	d := r.URL.Query().Get("deleted")
+	if d == "" {
+		return r.Context(), nil
+	}
+
+	deleted, err := strconv.ParseBool(d)
+	if err != nil {
+		return nil, fmt.Errorf("deleted: %w", err)
+	}
+	if deleted {
+		return product.WithDeleted(r.Context()), nil
+	}
+	return r.Context(), nil
+}
+
+func productListOptions(r *http.Request) (product.ListOptions, error) {
+	q := r.URL.Query()
+	o := product.ListOptions{
+		Name: q.Get("name"),
+		Sort: product.Sort(q.Get("sort")),
+	}
+
+	currency := money.DefaultCurrency
+	if c := q.Get("currency"); c != "" {
+		currency = money.Currency(c)
+	}
+
+	var err error
+	if o.MinPrice, err = parsePrice(q.Get("min_price"), currency); err != nil {
+		return o, fmt.Errorf("min_price: %w", err)
+	}
+	if o.MaxPrice, err = parsePrice(q.Get("max_price"), currency); err != nil {
+		return o, fmt.Errorf("max_price: %w", err)
+	}
+	if d := q.Get("desc"); d != "" {
+		if o.Desc, err = strconv.ParseBool(d); err != nil {
+			return o, fmt.Errorf("desc: %w", err)
+		}
+	}
+	if o.Limit, err = parseInt(q.Get("limit")); err != nil {
+		return o, fmt.Errorf("limit: %w", err)
+	}
+	if o.Offset, err = parseInt(q.Get("offset")); err != nil {
+		return o, fmt.Errorf("offset: %w", err)
+	}
+	if after := q.Get("after"); after != "" {
+		if o.After, err = product.ParseCursor(after); err != nil {
+			return o, err
+		}
+	}
+
+	return o, nil
+}
+
+// parsePrice returns nil when s is empty
+func parsePrice(s string, c money.Currency) (*money.Money, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m, err := money.Parse(s, c)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
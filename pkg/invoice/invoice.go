@@ -1,32 +1,329 @@
 package invoice
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoiceheader"
 	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/trace"
+	"time"
+)
+
+var (
+	ErrWithoutHeader   = errors.New("La factura no contiene encabezado")
+	ErrInvalidDiscount = errors.New("El descuento no puede ser negativo ni mayor al valor del item")
+	ErrInvalidStatus   = errors.New("La factura no puede pasar a ese estado")
+	ErrCreditNote      = errors.New("Una nota crédito no se puede anular")
 )
 
 // Model of invoice
 type Model struct {
-	Header *invoiceheader.Model
-	Items  invoiceitem.Models
+	Header *invoiceheader.Model `json:"header"`
+	Items  invoiceitem.Models   `json:"items"`
+}
+
+// Models slice of Model
+type Models []*Model
+
+// ComputeTotals sets the total of every item and the subtotal, tax and
+// total of the header. taxRate is in basis points (1900 is 19%) and the
+// tax is rounded half up. The currency of the invoice is the one of the
+// header or, when it is empty, the one of the first item; the prices
+// without currency are taken in it and the others must match it
+func (m *Model) ComputeTotals(taxRate uint) error {
+	if m.Header == nil {
+		return ErrWithoutHeader
+	}
+
+	currency := m.Header.Currency
+	if currency == "" && len(m.Items) > 0 {
+		currency = m.Items[0].UnitPrice.Currency
+	}
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if !currency.Valid() {
+		return fmt.Errorf("%w: %q", money.ErrUnknownCurrency, currency)
+	}
+
+	subtotal := money.New(0, currency)
+	for _, item := range m.Items {
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.UnitPrice.Currency == "" {
+			item.UnitPrice.Currency = currency
+		}
+		if item.Discount.Currency == "" {
+			item.Discount.Currency = currency
+		}
+		if item.UnitPrice.Currency != currency || item.Discount.Currency != currency {
+			return fmt.Errorf("producto %d: %w", item.ProductID, money.ErrCurrencyMismatch)
+		}
+
+		gross, err := item.UnitPrice.Mul(int64(item.Quantity))
+		if err != nil {
+			return fmt.Errorf("producto %d: %w", item.ProductID, err)
+		}
+		if item.Discount.IsNegative() || item.Discount.Amount > gross.Amount {
+			return fmt.Errorf("producto %d: %w", item.ProductID, ErrInvalidDiscount)
+		}
+		if err := item.ComputeTotal(); err != nil {
+			return fmt.Errorf("producto %d: %w", item.ProductID, err)
+		}
+		if subtotal, err = subtotal.Add(item.Total); err != nil {
+			return err
+		}
+	}
+
+	tax, err := subtotal.Percent(int64(taxRate))
+	if err != nil {
+		return err
+	}
+	total, err := subtotal.Add(tax)
+	if err != nil {
+		return err
+	}
+
+	m.Header.Currency = currency
+	m.Header.Subtotal = subtotal
+	m.Header.Tax = tax
+	m.Header.Total = total
+	return nil
+}
+
+// CreditNote returns the credit note that cancels the invoice, an issued
+// document with the amounts of the invoice negated
+func (m *Model) CreditNote() *Model {
+	cn := &Model{
+		Header: &invoiceheader.Model{
+			Client:      m.Header.Client,
+			Status:      invoiceheader.StatusIssued,
+			Kind:        invoiceheader.KindCreditNote,
+			ReferenceID: m.Header.ID,
+			Currency:    m.Header.Currency,
+			Subtotal:    m.Header.Subtotal.Neg(),
+			Tax:         m.Header.Tax.Neg(),
+			Total:       m.Header.Total.Neg(),
+		},
+		Items: make(invoiceitem.Models, 0, len(m.Items)),
+	}
+	for _, item := range m.Items {
+		cn.Items = append(cn.Items, &invoiceitem.Model{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice.Neg(),
+			Discount:  item.Discount.Neg(),
+			Total:     item.Total.Neg(),
+		})
+	}
+	return cn
 }
 
 // Storage interface that must implement a db storage
 type Storage interface {
-	Create(*Model) error
+	Create(context.Context, *Model) error
+	GetByID(context.Context, uint) (*Model, error)
+	List(context.Context, invoiceheader.Filter) (Models, error)
+	// ChangeStatus changes the status and records the change
+	ChangeStatus(context.Context, *invoiceheader.StatusChange) error
+	// Cancel changes the status like ChangeStatus and creates the credit
+	// note, when it is not nil, in the same transaction
+	Cancel(ctx context.Context, c *invoiceheader.StatusChange, creditNote *Model) error
+	StatusHistory(context.Context, uint) (invoiceheader.StatusChanges, error)
 }
 
 // Service of invoice
 type Service struct {
-	storage Storage
+	storage  Storage
+	products product.Storage
+	taxRate  uint
+	tracer   *trace.Tracer
+}
+
+// Option configures the Service
+type Option func(*Service)
+
+// WithProducts makes the service take the unit price of every item from
+// the product storage when the invoice is created
+func WithProducts(p product.Storage) Option {
+	return func(s *Service) {
+		s.products = p
+	}
+}
+
+// WithTaxRate sets the tax applied to the subtotal in basis points, 1900
+// is 19%
+func WithTaxRate(basisPoints uint) Option {
+	return func(s *Service) {
+		s.taxRate = basisPoints
+	}
+}
+
+// WithTracer makes the service start a span per operation, the spans of
+// the storages are its children
+func WithTracer(t *trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = t
+	}
 }
 
 // NewService returns a service pointer
-func NewService(s Storage) *Service {
-	return &Service{s}
+func NewService(s Storage, opts ...Option) *Service {
+	service := &Service{storage: s}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
+}
+
+// CreateContext creates a new invoice, the price of every item is taken
+// from the product storage (when the service has one) and the totals are
+// computed before saving it. The invoice starts as draft unless it is
+// created as issued
+func (s *Service) CreateContext(ctx context.Context, m *Model) (err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.Create")
+	defer func() { span.End(err) }()
+
+	if m.Header == nil {
+		return ErrWithoutHeader
+	}
+	switch m.Header.Status {
+	case "":
+		m.Header.Status = invoiceheader.StatusDraft
+	case invoiceheader.StatusDraft, invoiceheader.StatusIssued:
+	default:
+		return ErrInvalidStatus
+	}
+	m.Header.Kind = invoiceheader.KindInvoice
+	m.Header.ReferenceID = 0
+
+	if s.products != nil {
+		for _, item := range m.Items {
+			p, err := s.products.GetByID(ctx, item.ProductID)
+			if err != nil {
+				return fmt.Errorf("producto %d: %w", item.ProductID, err)
+			}
+			item.UnitPrice = p.Price
+		}
+	}
+
+	if err := m.ComputeTotals(s.taxRate); err != nil {
+		return err
+	}
+
+	return s.storage.Create(ctx, m)
+}
+
+// GetByIDContext returns the header and the items of an invoice
+func (s *Service) GetByIDContext(ctx context.Context, id uint) (_ *Model, err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.GetByID")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("invoice.id", id)
+	return s.storage.GetByID(ctx, id)
+}
+
+// ListContext returns the invoices that match the filter
+func (s *Service) ListContext(ctx context.Context, f invoiceheader.Filter) (_ Models, err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.List")
+	defer func() { span.End(err) }()
+	return s.storage.List(ctx, f)
+}
+
+// IssueContext issues a draft invoice, after that it can not change
+func (s *Service) IssueContext(ctx context.Context, id uint, reason string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.Issue")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("invoice.id", id)
+	return s.changeStatus(ctx, id, invoiceheader.StatusIssued, reason)
+}
+
+// PayContext marks an issued invoice as paid
+func (s *Service) PayContext(ctx context.Context, id uint, reason string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.Pay")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("invoice.id", id)
+	return s.changeStatus(ctx, id, invoiceheader.StatusPaid, reason)
+}
+
+// CancelContext cancels an invoice. Issued and paid invoices are not
+// modified, a credit note referencing them is created and returned. Draft
+// invoices are only cancelled and the credit note is nil
+func (s *Service) CancelContext(ctx context.Context, id uint, reason string) (_ *Model, err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.Cancel")
+	defer func() { span.End(err) }()
+	span.SetAttributes("invoice.id", id)
+
+	m, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newStatusChange(m, invoiceheader.StatusCancelled, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	var creditNote *Model
+	if m.Header.Status != invoiceheader.StatusDraft {
+		creditNote = m.CreditNote()
+	}
+
+	if err := s.storage.Cancel(ctx, c, creditNote); err != nil {
+		return nil, err
+	}
+	return creditNote, nil
+}
+
+// HistoryContext returns the status changes of an invoice, the oldest first
+func (s *Service) HistoryContext(ctx context.Context, id uint) (_ invoiceheader.StatusChanges, err error) {
+	ctx, span := s.tracer.Start(ctx, "invoice.History")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("invoice.id", id)
+	return s.storage.StatusHistory(ctx, id)
+}
+
+func (s *Service) changeStatus(ctx context.Context, id uint, to invoiceheader.Status, reason string) error {
+	m, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	c, err := newStatusChange(m, to, reason)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.ChangeStatus(ctx, c)
+}
+
+func newStatusChange(m *Model, to invoiceheader.Status, reason string) (*invoiceheader.StatusChange, error) {
+	if m.Header.Kind == invoiceheader.KindCreditNote {
+		return nil, ErrCreditNote
+	}
+	if !m.Header.Status.CanChangeTo(to) {
+		return nil, fmt.Errorf("%w: de %s a %s", ErrInvalidStatus, m.Header.Status, to)
+	}
+
+	return &invoiceheader.StatusChange{
+		InvoiceHeaderID: m.Header.ID,
+		From:            m.Header.Status,
+		To:              to,
+		Reason:          reason,
+		CreatedAt:       time.Now(),
+	}, nil
 }
 
 // Create creates a new invoice
+//
+// Deprecated: use CreateContext
 func (s *Service) Create(m *Model) error {
-	return s.storage.Create(m)
+	return s.CreateContext(context.Background(), m)
 }
@@ -0,0 +1,361 @@
+package invoice_test
+
+import (
+	"context"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/storage"
+	"github.com/eltaljohn/go-db/pkg/trace"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeTotals(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   invoiceitem.Models
+		taxRate uint
+		wantErr error
+		// want subtotal, tax and total of the header in USD cents
+		want [3]int64
+	}{
+		{name: "without items", taxRate: 1900},
+		{
+			name:    "quantity defaults to one",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(1000, "USD")}},
+			taxRate: 1900,
+			want:    [3]int64{1000, 190, 1190},
+		},
+		{
+			name: "quantity and discount",
+			items: invoiceitem.Models{
+				{ProductID: 1, Quantity: 3, UnitPrice: money.New(1000, "USD"), Discount: money.New(500, "USD")},
+				{ProductID: 2, Quantity: 2, UnitPrice: money.New(250, "USD")},
+			},
+			want: [3]int64{3000, 0, 3000},
+		},
+		{
+			name:    "tax rounds half up",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(50, "USD")}},
+			taxRate: 1000,
+			want:    [3]int64{50, 5, 55},
+		},
+		{
+			name:    "tax rounds down",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(44, "USD")}},
+			taxRate: 1000,
+			want:    [3]int64{44, 4, 48},
+		},
+		{
+			name:    "negative discount",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(100, "USD"), Discount: money.New(-1, "USD")}},
+			wantErr: invoice.ErrInvalidDiscount,
+		},
+		{
+			name:    "discount greater than the line",
+			items:   invoiceitem.Models{{ProductID: 1, Quantity: 2, UnitPrice: money.New(100, "USD"), Discount: money.New(201, "USD")}},
+			wantErr: invoice.ErrInvalidDiscount,
+		},
+		{
+			name:    "mixed currencies",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(100, "USD")}, {ProductID: 2, UnitPrice: money.New(100, "EUR")}},
+			wantErr: money.ErrCurrencyMismatch,
+		},
+		{
+			name:    "line overflow",
+			items:   invoiceitem.Models{{ProductID: 1, Quantity: 3, UnitPrice: money.New(math.MaxInt64/2, "USD")}},
+			wantErr: money.ErrOverflow,
+		},
+		{
+			name: "subtotal overflow",
+			items: invoiceitem.Models{
+				{ProductID: 1, UnitPrice: money.New(math.MaxInt64/2+1, "USD")},
+				{ProductID: 2, UnitPrice: money.New(math.MaxInt64/2+1, "USD")},
+			},
+			wantErr: money.ErrOverflow,
+		},
+		{
+			name:    "tax overflow",
+			items:   invoiceitem.Models{{ProductID: 1, UnitPrice: money.New(math.MaxInt64/1000, "USD")}},
+			taxRate: 1900,
+			wantErr: money.ErrOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &invoice.Model{Header: &invoiceheader.Model{Client: "Alexys"}, Items: tt.items}
+
+			err := m.ComputeTotals(tt.taxRate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got := [3]int64{m.Header.Subtotal.Amount, m.Header.Tax.Amount, m.Header.Total.Amount}
+			if got != tt.want || m.Header.Currency != "USD" || m.Header.Total.Currency != "USD" {
+				t.Errorf("subtotal, tax, total = %v %s, want %v USD", got, m.Header.Currency, tt.want)
+			}
+			for _, item := range m.Items {
+				if item.Total.Amount != int64(item.Quantity)*item.UnitPrice.Amount-item.Discount.Amount {
+					t.Errorf("item %d: total = %v", item.ProductID, item.Total)
+				}
+			}
+		})
+	}
+
+	if err := (&invoice.Model{}).ComputeTotals(0); !errors.Is(err, invoice.ErrWithoutHeader) {
+		t.Errorf("without header: err = %v, want %v", err, invoice.ErrWithoutHeader)
+	}
+}
+
+// TestServiceCreatePrices checks that the unit prices are taken from the
+// products and not from the request
+func TestServiceCreatePrices(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewMemoryDB()
+	products := storage.NewMemoryProduct(db)
+	if err := products.Create(ctx, &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	service := invoice.NewService(storage.NewMemoryInvoice(db), invoice.WithProducts(products), invoice.WithTaxRate(1900))
+	m := &invoice.Model{
+		Header: &invoiceheader.Model{Client: "Alexys"},
+		Items:  invoiceitem.Models{{ProductID: 1, Quantity: 2, UnitPrice: money.New(1, "USD")}},
+	}
+	if err := service.CreateContext(ctx, m); err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	if m.Items[0].UnitPrice != money.New(1000, "USD") || m.Header.Total != money.New(2380, "USD") {
+		t.Errorf("unit price %v total %v, want 10.00 USD and 23.80 USD", m.Items[0].UnitPrice, m.Header.Total)
+	}
+
+	m = &invoice.Model{
+		Header: &invoiceheader.Model{Client: "Alexys"},
+		Items:  invoiceitem.Models{{ProductID: 9}},
+	}
+	if err := service.CreateContext(ctx, m); err == nil {
+		t.Errorf("CreateContext of a missing product did not fail")
+	}
+}
+
+// openStores returns a Memory store and a migrated SQLite store, both with
+// one product
+func openStores(t *testing.T, opts ...storage.Option) map[string]*storage.Store {
+	t.Helper()
+	ctx := context.Background()
+
+	stores := make(map[string]*storage.Store)
+	for name, c := range map[string]storage.Config{
+		"memory": {Driver: storage.Memory},
+		"sqlite": {Driver: storage.SQLite, Path: filepath.Join(t.TempDir(), "go-db.sqlite")},
+	} {
+		store, err := storage.Open(c, opts...)
+		if err != nil {
+			t.Fatalf("Open %s: %v", name, err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		if c.Driver != storage.Memory {
+			m, err := store.Migrator()
+			if err != nil {
+				t.Fatalf("Migrator %s: %v", name, err)
+			}
+			if err := m.Up(ctx); err != nil {
+				t.Fatalf("Up %s: %v", name, err)
+			}
+		}
+		if err := store.Product().Create(ctx, &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		stores[name] = store
+	}
+	return stores
+}
+
+func newInvoice() *invoice.Model {
+	return &invoice.Model{
+		Header: &invoiceheader.Model{Client: "Alexys"},
+		Items:  invoiceitem.Models{{ProductID: 1, Quantity: 2, Discount: money.New(100, "USD")}},
+	}
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			service := invoice.NewService(store.Invoice(), invoice.WithProducts(store.Product()))
+			m := newInvoice()
+			if err := service.CreateContext(ctx, m); err != nil {
+				t.Fatalf("CreateContext: %v", err)
+			}
+			if m.Header.Status != invoiceheader.StatusDraft || m.Header.Kind != invoiceheader.KindInvoice {
+				t.Fatalf("status %q kind %q, want draft invoice", m.Header.Status, m.Header.Kind)
+			}
+			id := m.Header.ID
+
+			if err := service.PayContext(ctx, id, "pago"); !errors.Is(err, invoice.ErrInvalidStatus) {
+				t.Errorf("pay a draft: err = %v, want %v", err, invoice.ErrInvalidStatus)
+			}
+			if err := service.IssueContext(ctx, id, "enviada"); err != nil {
+				t.Fatalf("IssueContext: %v", err)
+			}
+			if err := service.IssueContext(ctx, id, "otra vez"); !errors.Is(err, invoice.ErrInvalidStatus) {
+				t.Errorf("issue twice: err = %v, want %v", err, invoice.ErrInvalidStatus)
+			}
+			if err := service.PayContext(ctx, id, "pago"); err != nil {
+				t.Fatalf("PayContext: %v", err)
+			}
+
+			got, err := service.GetByIDContext(ctx, id)
+			if err != nil {
+				t.Fatalf("GetByIDContext: %v", err)
+			}
+			if got.Header.Status != invoiceheader.StatusPaid {
+				t.Errorf("status = %q, want %q", got.Header.Status, invoiceheader.StatusPaid)
+			}
+
+			history, err := service.HistoryContext(ctx, id)
+			if err != nil {
+				t.Fatalf("HistoryContext: %v", err)
+			}
+			want := [][2]invoiceheader.Status{
+				{invoiceheader.StatusDraft, invoiceheader.StatusIssued},
+				{invoiceheader.StatusIssued, invoiceheader.StatusPaid},
+			}
+			if len(history) != len(want) {
+				t.Fatalf("history has %d changes, want %d", len(history), len(want))
+			}
+			for i, c := range history {
+				if [2]invoiceheader.Status{c.From, c.To} != want[i] || c.InvoiceHeaderID != id {
+					t.Errorf("change %d = %+v, want %v", i, c, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServiceCancel(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			service := invoice.NewService(store.Invoice(), invoice.WithProducts(store.Product()), invoice.WithTaxRate(1900))
+
+			draft := newInvoice()
+			if err := service.CreateContext(ctx, draft); err != nil {
+				t.Fatalf("CreateContext: %v", err)
+			}
+			creditNote, err := service.CancelContext(ctx, draft.Header.ID, "duplicada")
+			if err != nil {
+				t.Fatalf("cancel a draft: %v", err)
+			}
+			if creditNote != nil {
+				t.Errorf("cancel a draft returned the credit note %+v", creditNote.Header)
+			}
+
+			m := newInvoice()
+			m.Header.Status = invoiceheader.StatusIssued
+			if err := service.CreateContext(ctx, m); err != nil {
+				t.Fatalf("CreateContext: %v", err)
+			}
+			creditNote, err = service.CancelContext(ctx, m.Header.ID, "error en el precio")
+			if err != nil {
+				t.Fatalf("cancel an issued invoice: %v", err)
+			}
+			if creditNote == nil {
+				t.Fatal("cancel an issued invoice did not return the credit note")
+			}
+
+			got, err := service.GetByIDContext(ctx, creditNote.Header.ID)
+			if err != nil {
+				t.Fatalf("GetByIDContext of the credit note: %v", err)
+			}
+			h := got.Header
+			if h.Kind != invoiceheader.KindCreditNote || h.Status != invoiceheader.StatusIssued || h.ReferenceID != m.Header.ID {
+				t.Errorf("credit note kind %q status %q reference %d", h.Kind, h.Status, h.ReferenceID)
+			}
+			if h.Subtotal != m.Header.Subtotal.Neg() || h.Tax != m.Header.Tax.Neg() || h.Total != m.Header.Total.Neg() || !h.Total.IsNegative() {
+				t.Errorf("credit note totals %v %v %v, invoice %v %v %v", h.Subtotal, h.Tax, h.Total, m.Header.Subtotal, m.Header.Tax, m.Header.Total)
+			}
+			if len(got.Items) != 1 || got.Items[0].Total != m.Items[0].Total.Neg() || got.Items[0].UnitPrice != money.New(-1000, "USD") {
+				t.Errorf("credit note items %+v", got.Items)
+			}
+
+			original, err := service.GetByIDContext(ctx, m.Header.ID)
+			if err != nil {
+				t.Fatalf("GetByIDContext: %v", err)
+			}
+			if original.Header.Status != invoiceheader.StatusCancelled || original.Header.Total != m.Header.Total {
+				t.Errorf("cancelled invoice status %q total %v", original.Header.Status, original.Header.Total)
+			}
+
+			if _, err := service.CancelContext(ctx, m.Header.ID, "otra vez"); !errors.Is(err, invoice.ErrInvalidStatus) {
+				t.Errorf("cancel twice: err = %v, want %v", err, invoice.ErrInvalidStatus)
+			}
+			if _, err := service.CancelContext(ctx, creditNote.Header.ID, "nota"); !errors.Is(err, invoice.ErrCreditNote) {
+				t.Errorf("cancel a credit note: err = %v, want %v", err, invoice.ErrCreditNote)
+			}
+		})
+	}
+}
+
+func TestServiceCreateSpans(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+
+	for name, store := range openStores(t, storage.WithTracer(tracer)) {
+		t.Run(name, func(t *testing.T) {
+			exporter.Reset()
+			service := invoice.NewService(store.Invoice(), invoice.WithProducts(store.Product()), invoice.WithTracer(tracer))
+			if err := service.CreateContext(context.Background(), newInvoice()); err != nil {
+				t.Fatalf("CreateContext: %v", err)
+			}
+
+			spans := make(map[string]*trace.Span)
+			for _, s := range exporter.Spans() {
+				spans[s.Name] = s
+			}
+			root := spans["invoice.Create"]
+			if root == nil || root.ParentID != "" {
+				t.Fatalf("root span = %+v, want invoice.Create without parent", root)
+			}
+
+			// every step of the transaction is a child of the storage span,
+			// child of the one of the service
+			parents := map[string]string{
+				"products.get":           "invoice.Create",
+				"invoices.create":        "invoice.Create",
+				"invoice_headers.insert": "invoices.create",
+				"invoice_items.insert":   "invoices.create",
+				"commit":                 "invoices.create",
+			}
+			for name, parent := range parents {
+				s := spans[name]
+				if s == nil {
+					t.Errorf("span %s not exported", name)
+					continue
+				}
+				if s.TraceID != root.TraceID || s.ParentID != spans[parent].SpanID {
+					t.Errorf("span %s is not a child of %s in the trace", name, parent)
+				}
+				if s.EndTime.IsZero() || s.Err != nil {
+					t.Errorf("span %s ended at %v with error %v", name, s.EndTime, s.Err)
+				}
+			}
+			if s := spans["invoices.create"]; s.Attributes["db.row_id"] != uint(1) || s.Attributes["items"] != 1 {
+				t.Errorf("invoices.create attributes = %v", s.Attributes)
+			}
+			if len(exporter.Spans()) != len(parents)+1 {
+				t.Errorf("%d spans exported, want %d", len(exporter.Spans()), len(parents)+1)
+			}
+		})
+	}
+}
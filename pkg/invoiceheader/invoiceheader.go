@@ -1,21 +1,119 @@
 package invoiceheader
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/money"
 	"time"
 )
 
+var (
+	ErrStatusChanged = errors.New("La factura no existe o cambió de estado")
+)
+
+// Status of an invoice in its lifecycle
+type Status string
+
+// Statuses, an invoice goes from draft to issued and paid and it can be
+// cancelled at any point
+const (
+	StatusDraft     Status = "draft"
+	StatusIssued    Status = "issued"
+	StatusPaid      Status = "paid"
+	StatusCancelled Status = "cancelled"
+)
+
+// transitions allowed from every status
+var transitions = map[Status][]Status{
+	StatusDraft:  {StatusIssued, StatusCancelled},
+	StatusIssued: {StatusPaid, StatusCancelled},
+	StatusPaid:   {StatusCancelled},
+}
+
+// CanChangeTo reports whether an invoice in status s can go to status to
+func (s Status) CanChangeTo(to Status) bool {
+	for _, t := range transitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind of document
+type Kind string
+
+// Kinds, a credit note cancels the invoice of its ReferenceID
+const (
+	KindInvoice    Kind = "invoice"
+	KindCreditNote Kind = "credit_note"
+)
+
 // Model of invoiceheader
 type Model struct {
-	ID        uint
-	Client    string
-	CreateAt  time.Time
-	UpdatedAt time.Time
+	ID     uint   `json:"id"`
+	Client string `json:"client"`
+	Status Status `json:"status"`
+	Kind   Kind   `json:"kind"`
+	// ReferenceID is the invoice cancelled by a credit note
+	ReferenceID uint `json:"reference_id,omitempty"`
+	// Currency of every amount of the invoice and its items
+	Currency money.Currency `json:"currency"`
+	// Subtotal is the sum of the totals of the items, Total adds the Tax
+	Subtotal  money.Money `json:"subtotal"`
+	Tax       money.Money `json:"tax"`
+	Total     money.Money `json:"total"`
+	CreateAt  time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Models slice of Model
+type Models []*Model
+
+// Limits of List, DefaultLimit is used when the filter does not have one
+// and greater limits are cut to MaxLimit
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Filter of List, the zero value of a field does not filter
+type Filter struct {
+	// Client is matched as a case insensitive substring
+	Client string
+	// From and To limit CreateAt to [From, To)
+	From time.Time
+	To   time.Time
+	// Status keeps only the invoices in that status
+	Status Status
+	// Limit and Offset paginate the result, it is ordered from the newest
+	Limit  int
+	Offset int
 }
 
+// StatusChange of an invoice, the changes are kept as history
+type StatusChange struct {
+	ID              uint      `json:"id"`
+	InvoiceHeaderID uint      `json:"invoice_header_id"`
+	From            Status    `json:"from"`
+	To              Status    `json:"to"`
+	Reason          string    `json:"reason"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// StatusChanges slice of StatusChange
+type StatusChanges []*StatusChange
+
 type Storage interface {
-	Migrate() error
-	CreateTx(tx *sql.Tx, model *Model) error
+	Migrate(context.Context) error
+	CreateTx(ctx context.Context, tx *sql.Tx, model *Model) error
+	GetByID(context.Context, uint) (*Model, error)
+	List(context.Context, Filter) (Models, error)
+	// ChangeStatusTx must fail with ErrStatusChanged when the invoice is
+	// not in the From status anymore
+	ChangeStatusTx(context.Context, *sql.Tx, *StatusChange) error
+	StatusHistory(context.Context, uint) (StatusChanges, error)
 }
 
 // Service of invoiceheader
@@ -28,7 +126,14 @@ func NewService(s Storage) *Service {
 	return &Service{s}
 }
 
+// MigrateContext is used to migrate invoiceheader
+func (s Service) MigrateContext(ctx context.Context) error {
+	return s.storage.Migrate(ctx)
+}
+
 // Migrate is used to migrate invoiceheader
+//
+// Deprecated: use MigrateContext
 func (s Service) Migrate() error {
-	return s.storage.Migrate()
+	return s.MigrateContext(context.Background())
 }
@@ -1,25 +1,54 @@
 package invoiceitem
 
 import (
+	"context"
 	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/money"
 	"time"
 )
 
 // Model of invoiceitem
 type Model struct {
-	ID              uint
-	InvoiceHeaderID uint
-	ProductID       uint
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID              uint `json:"id"`
+	InvoiceHeaderID uint `json:"invoice_header_id"`
+	ProductID       uint `json:"product_id"`
+	// ProductName is only filled when the item is read
+	ProductName string `json:"product_name,omitempty"`
+	Quantity    uint   `json:"quantity"`
+	// UnitPrice is the price of the product when it was sold
+	UnitPrice money.Money `json:"unit_price"`
+	// Discount is applied to the whole line
+	Discount  money.Money `json:"discount"`
+	Total     money.Money `json:"total"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// ComputeTotal sets the total of the line, Quantity * UnitPrice - Discount,
+// the prices must have the same currency
+func (m *Model) ComputeTotal() error {
+	gross, err := m.UnitPrice.Mul(int64(m.Quantity))
+	if err != nil {
+		return err
+	}
+	total, err := gross.Sub(m.Discount)
+	if err != nil {
+		return err
+	}
+	m.Total = total
+	return nil
 }
 
 // Models slice of Model
 type Models []*Model
 
 type Storage interface {
-	Migrate() error
-	CreateTx(*sql.Tx, uint, Models) error
+	Migrate(context.Context) error
+	CreateTx(context.Context, *sql.Tx, uint, Models) error
+	GetByHeaderID(context.Context, uint) (Models, error)
+	// GetByHeaderIDs returns the items of every header in one query,
+	// sorted by header and id
+	GetByHeaderIDs(context.Context, []uint) (Models, error)
 }
 
 // Service of invoiceitem
@@ -32,7 +61,14 @@ func NewService(s Storage) *Service {
 	return &Service{s}
 }
 
+// MigrateContext is used to migrate invoiceitem
+func (s Service) MigrateContext(ctx context.Context) error {
+	return s.storage.Migrate(ctx)
+}
+
 // Migrate is used to migrate invoiceitem
+//
+// Deprecated: use MigrateContext
 func (s Service) Migrate() error {
-	return s.storage.Migrate()
+	return s.MigrateContext(context.Background())
 }
@@ -0,0 +1,368 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("la migración aplicada fue modificada")
+	ErrUnknownVersion   = errors.New("no existe la migración con esa versión")
+	ErrMissingDown      = errors.New("la migración no tiene down")
+)
+
+// Dialect of the db, it changes the DDL of schema_migrations and the
+// placeholders of the queries
+type Dialect string
+
+// Dialects
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+)
+
+// schemaMigrations DDL of the table that keeps the applied migrations
+var schemaMigrations = map[Dialect]string{
+	Postgres: `CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT now(),
+	CONSTRAINT schema_migrations_version_pk PRIMARY KEY (version)
+)`,
+	MySQL: `CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT now()
+)`,
+	SQLite: `CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`,
+}
+
+const (
+	getAppliedMigrations = `SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version`
+	createMigration      = `INSERT INTO schema_migrations(version, name, checksum) VALUES (?, ?, ?)`
+	deleteMigration      = `DELETE FROM schema_migrations WHERE version = ?`
+)
+
+// Migration is a versioned change of the schema. Up and Down hold one
+// statement per element. A released migration must not change, add a new
+// version instead
+type Migration struct {
+	Version uint
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// Checksum returns the sha256 of the up statements
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(strings.Join(m.Up, ";\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status of a migration in the db
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is true when the checksum recorded when it was applied
+	// does not match the current one
+	Modified bool
+}
+
+// Error of a migration, it keeps the statement that failed
+type Error struct {
+	Version   uint
+	Name      string
+	Direction string
+	Statement string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	if e.Statement == "" {
+		return fmt.Sprintf("migration %d %s (%s): %v", e.Version, e.Name, e.Direction, e.Err)
+	}
+	return fmt.Sprintf("migration %d %s (%s) %q: %v", e.Version, e.Name, e.Direction, TrimStatement(e.Statement), e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// statementMaxLength of the statements shown by the errors
+const statementMaxLength = 80
+
+// TrimStatement returns the statement in one line, with its spaces
+// collapsed and cut to statementMaxLength runes
+func TrimStatement(stmt string) string {
+	s := strings.Join(strings.Fields(stmt), " ")
+	if r := []rune(s); len(r) > statementMaxLength {
+		s = string(r[:statementMaxLength-3]) + "..."
+	}
+	return s
+}
+
+// Migrator applies the migrations of a dialect over a db
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New returns a new pointer of Migrator, migrations are sorted by version
+// and the versions must be unique and greater than zero
+func New(db *sql.DB, d Dialect, ms []Migration) (*Migrator, error) {
+	if _, ok := schemaMigrations[d]; !ok {
+		return nil, fmt.Errorf("dialect not implemented: %q", d)
+	}
+
+	sorted := make([]Migration, len(ms))
+	copy(sorted, ms)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version == 0 {
+			return nil, fmt.Errorf("migration %q: version must be greater than zero", m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration %d: duplicated version", m.Version)
+		}
+	}
+
+	return &Migrator{db, d, sorted}, nil
+}
+
+// bind rewrites the ? placeholders for the dialect
+func (m *Migrator) bind(query string) string {
+	if m.dialect != Postgres {
+		return query
+	}
+	b := strings.Builder{}
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// record of an applied migration in schema_migrations
+type record struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// applied returns the records of schema_migrations by version
+func (m *Migrator) applied(ctx context.Context) (map[uint]record, error) {
+	if _, err := m.db.ExecContext(ctx, schemaMigrations[m.dialect]); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, getAppliedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[uint]record)
+	for rows.Next() {
+		var version uint
+		r := record{}
+		if err := rows.Scan(&version, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = r
+	}
+
+	return applied, rows.Err()
+}
+
+// Status returns the status of every known migration and of the applied
+// ones that are not known anymore
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = r.appliedAt
+			s.Modified = r.checksum != mig.Checksum()
+			delete(applied, mig.Version)
+		}
+		ss = append(ss, s)
+	}
+	for version, r := range applied {
+		ss = append(ss, Status{
+			Migration: Migration{Version: version},
+			Applied:   true,
+			AppliedAt: r.appliedAt,
+		})
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Version < ss[j].Version })
+
+	return ss, nil
+}
+
+// Version returns the greatest applied version, zero if there is none
+func (m *Migrator) Version(ctx context.Context) (uint, error) {
+	ss, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint
+	for _, s := range ss {
+		if s.Applied {
+			v = s.Version
+		}
+	}
+	return v, nil
+}
+
+// Up applies every pending migration in order
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the last n applied migrations
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	ss, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(ss) - 1; i >= 0 && n > 0; i-- {
+		if !ss[i].Applied {
+			continue
+		}
+		if err := m.down(ctx, ss[i].Migration); err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// Goto applies or reverts migrations until version is the last applied
+// one, zero reverts all of them
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	ss, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range ss {
+		if s.Applied && s.Modified {
+			return &Error{s.Version, s.Name, "up", "", ErrChecksumMismatch}
+		}
+	}
+
+	for i := len(ss) - 1; i >= 0; i-- {
+		if ss[i].Applied && ss[i].Version > version {
+			if err := m.down(ctx, ss[i].Migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range ss {
+		if !s.Applied && s.Version <= version {
+			if err := m.up(ctx, s.Migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) find(version uint) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// up applies a migration and records it inside a transaction. MySQL
+// commits implicitly after every DDL statement so a failing migration can
+// be partially applied there
+func (m *Migrator) up(ctx context.Context, mig Migration) error {
+	return m.run(ctx, mig, "up", mig.Up, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, m.bind(createMigration), mig.Version, mig.Name, mig.Checksum())
+		return err
+	})
+}
+
+// down reverts a migration and removes its record inside a transaction
+func (m *Migrator) down(ctx context.Context, mig Migration) error {
+	i := m.find(mig.Version)
+	if i < 0 {
+		return &Error{mig.Version, mig.Name, "down", "", ErrUnknownVersion}
+	}
+	mig = m.migrations[i]
+	if len(mig.Down) == 0 {
+		return &Error{mig.Version, mig.Name, "down", "", ErrMissingDown}
+	}
+
+	return m.run(ctx, mig, "down", mig.Down, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, m.bind(deleteMigration), mig.Version)
+		return err
+	})
+}
+
+func (m *Migrator) run(ctx context.Context, mig Migration, direction string, stmts []string, record func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &Error{mig.Version, mig.Name, direction, "", err}
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return &Error{mig.Version, mig.Name, direction, stmt, err}
+		}
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return &Error{mig.Version, mig.Name, direction, "", err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &Error{mig.Version, mig.Name, direction, "", err}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_a",
+		Up:      []string{"CREATE TABLE a(id INTEGER PRIMARY KEY)"},
+		Down:    []string{"DROP TABLE a"},
+	},
+	{
+		Version: 2,
+		Name:    "create_b",
+		Up:      []string{"CREATE TABLE b(id INTEGER PRIMARY KEY)", "CREATE INDEX b_id_idx ON b(id)"},
+		Down:    []string{"DROP TABLE b"},
+	},
+	{
+		Version: 3,
+		Name:    "create_c",
+		Up:      []string{"CREATE TABLE c(id INTEGER PRIMARY KEY)"},
+		Down:    []string{"DROP TABLE c"},
+	},
+}
+
+// openSQLite opens an empty SQLite db in a temp file
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrate.sqlite"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// tables returns which of the tables a, b and c exist
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	var ts []string
+	for _, name := range []string{"a", "b", "c"} {
+		var n int
+		err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+		if err != nil {
+			t.Fatalf("sqlite_master: %v", err)
+		}
+		if n == 1 {
+			ts = append(ts, name)
+		}
+	}
+	return ts
+}
+
+func TestMigrator(t *testing.T) {
+	tests := []struct {
+		name        string
+		run         func(context.Context, *Migrator) error
+		wantVersion uint
+		wantTables  []string
+	}{
+		{
+			name:        "up",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx) },
+			wantVersion: 3,
+			wantTables:  []string{"a", "b", "c"},
+		},
+		{
+			name: "up twice",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx); err != nil {
+					return err
+				}
+				return m.Up(ctx)
+			},
+			wantVersion: 3,
+			wantTables:  []string{"a", "b", "c"},
+		},
+		{
+			name: "down",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx); err != nil {
+					return err
+				}
+				return m.Down(ctx, 2)
+			},
+			wantVersion: 1,
+			wantTables:  []string{"a"},
+		},
+		{
+			name:        "goto forward",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Goto(ctx, 2) },
+			wantVersion: 2,
+			wantTables:  []string{"a", "b"},
+		},
+		{
+			name: "goto back",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx); err != nil {
+					return err
+				}
+				return m.Goto(ctx, 1)
+			},
+			wantVersion: 1,
+			wantTables:  []string{"a"},
+		},
+		{
+			name: "goto zero",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx); err != nil {
+					return err
+				}
+				return m.Goto(ctx, 0)
+			},
+		},
+		{
+			name: "round trip",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx); err != nil {
+					return err
+				}
+				if err := m.Down(ctx, 3); err != nil {
+					return err
+				}
+				return m.Up(ctx)
+			},
+			wantVersion: 3,
+			wantTables:  []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openSQLite(t)
+			m, err := New(db, SQLite, testMigrations)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			if err := tt.run(ctx, m); err != nil {
+				t.Fatalf("run: %v", err)
+			}
+
+			v, err := m.Version(ctx)
+			if err != nil {
+				t.Fatalf("Version: %v", err)
+			}
+			if v != tt.wantVersion {
+				t.Errorf("version = %d, want %d", v, tt.wantVersion)
+			}
+
+			got := tables(t, db)
+			if len(got) != len(tt.wantTables) {
+				t.Fatalf("tables = %v, want %v", got, tt.wantTables)
+			}
+			for i := range got {
+				if got[i] != tt.wantTables[i] {
+					t.Errorf("tables = %v, want %v", got, tt.wantTables)
+				}
+			}
+		})
+	}
+}
+
+func TestMigratorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// applied migrations before run
+		applied uint
+		// migrations of the migrator of run, testMigrations if nil
+		migrations    func() []Migration
+		run           func(context.Context, *Migrator) error
+		wantErr       error
+		wantStatement string
+		wantVersion   uint
+	}{
+		{
+			name:        "unknown version",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Goto(ctx, 9) },
+			wantErr:     ErrUnknownVersion,
+			wantVersion: 0,
+		},
+		{
+			name:    "checksum mismatch",
+			applied: 2,
+			migrations: func() []Migration {
+				ms := append([]Migration(nil), testMigrations...)
+				ms[1].Up = []string{"CREATE TABLE b(id INTEGER PRIMARY KEY, name TEXT)"}
+				return ms
+			},
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx) },
+			wantErr:     ErrChecksumMismatch,
+			wantVersion: 2,
+		},
+		{
+			name:    "missing down",
+			applied: 3,
+			migrations: func() []Migration {
+				ms := append([]Migration(nil), testMigrations...)
+				ms[2].Down = nil
+				return ms
+			},
+			run:         func(ctx context.Context, m *Migrator) error { return m.Down(ctx, 1) },
+			wantErr:     ErrMissingDown,
+			wantVersion: 3,
+		},
+		{
+			name:    "failing statement is rolled back",
+			applied: 1,
+			migrations: func() []Migration {
+				ms := append([]Migration(nil), testMigrations...)
+				ms[1].Up = []string{"CREATE TABLE b(id INTEGER PRIMARY KEY)", "CREATE TABLE a(id INTEGER)"}
+				return ms
+			},
+			run:           func(ctx context.Context, m *Migrator) error { return m.Up(ctx) },
+			wantStatement: "CREATE TABLE a(id INTEGER)",
+			wantVersion:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openSQLite(t)
+
+			if tt.applied > 0 {
+				m, err := New(db, SQLite, testMigrations)
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+				if err := m.Goto(ctx, tt.applied); err != nil {
+					t.Fatalf("Goto: %v", err)
+				}
+			}
+
+			ms := testMigrations
+			if tt.migrations != nil {
+				ms = tt.migrations()
+			}
+			m, err := New(db, SQLite, ms)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			err = tt.run(ctx, m)
+			if err == nil {
+				t.Fatal("run did not fail")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantStatement != "" {
+				var merr *Error
+				if !errors.As(err, &merr) || merr.Statement != tt.wantStatement {
+					t.Errorf("err = %v, want the statement %q", err, tt.wantStatement)
+				}
+				if !strings.Contains(err.Error(), tt.wantStatement) {
+					t.Errorf("err = %q, want it to show the statement %q", err, tt.wantStatement)
+				}
+				if got := tables(t, db); len(got) != 1 {
+					t.Errorf("tables = %v, the failed migration was not rolled back", got)
+				}
+			}
+
+			v, err := m.Version(ctx)
+			if err != nil {
+				t.Fatalf("Version: %v", err)
+			}
+			if v != tt.wantVersion {
+				t.Errorf("version = %d, want %d", v, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestStatusModified(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	m, err := New(db, SQLite, testMigrations)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := m.Goto(ctx, 2); err != nil {
+		t.Fatalf("Goto: %v", err)
+	}
+
+	ms := append([]Migration(nil), testMigrations...)
+	ms[0].Up = []string{"CREATE TABLE a(id BIGINT PRIMARY KEY)"}
+	m, err = New(db, SQLite, ms)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ss, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	want := []struct{ applied, modified bool }{{true, true}, {true, false}, {false, false}}
+	if len(ss) != len(want) {
+		t.Fatalf("Status returned %d migrations, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if s.Applied != want[i].applied || s.Modified != want[i].modified {
+			t.Errorf("migration %d: applied %v modified %v, want %v %v", s.Version, s.Applied, s.Modified, want[i].applied, want[i].modified)
+		}
+	}
+}
+
+func TestTrimStatement(t *testing.T) {
+	long := "CREATE TABLE products(" + strings.Repeat("name VARCHAR(25), ", 10) + "id INT)"
+
+	tests := []struct {
+		name string
+		stmt string
+		want string
+	}{
+		{name: "one line", stmt: "DROP TABLE a", want: "DROP TABLE a"},
+		{name: "spaces", stmt: "CREATE TABLE a(\n\tid INT,\n\tname TEXT\n)", want: "CREATE TABLE a( id INT, name TEXT )"},
+		{name: "long", stmt: long, want: long[:statementMaxLength-3] + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimStatement(tt.stmt); got != tt.want {
+				t.Errorf("TrimStatement = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
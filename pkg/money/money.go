@@ -0,0 +1,234 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("Las monedas no coinciden")
+	ErrUnknownCurrency  = errors.New("La moneda no es válida")
+	ErrInvalidAmount    = errors.New("El valor no es válido")
+	ErrOverflow         = errors.New("El valor excede el máximo permitido")
+)
+
+// Currency is an ISO 4217 code
+type Currency string
+
+// DefaultCurrency of the prices that were stored without currency
+const DefaultCurrency Currency = "USD"
+
+// exponents are the decimals of the minor unit of the supported currencies
+var exponents = map[Currency]int{
+	"ARS": 2, "BRL": 2, "CAD": 2, "CHF": 2, "COP": 2, "EUR": 2, "GBP": 2,
+	"MXN": 2, "PEN": 2, "USD": 2, "UYU": 2,
+	"CLP": 0, "JPY": 0, "KRW": 0, "PYG": 0,
+	"BHD": 3, "KWD": 3,
+}
+
+// Valid reports whether the currency is supported
+func (c Currency) Valid() bool {
+	_, ok := exponents[c]
+	return ok
+}
+
+// Exponent returns the decimals of the minor unit, 2 if the currency is
+// not supported
+func (c Currency) Exponent() int {
+	if e, ok := exponents[c]; ok {
+		return e
+	}
+	return 2
+}
+
+// Money is an amount in the minor unit of its currency, e.g. cents. The
+// zero value has no currency and it can be added to any Money
+type Money struct {
+	Amount   int64    `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// New returns the Money of amount minor units of c
+func New(amount int64, c Currency) Money {
+	return Money{amount, c}
+}
+
+// Parse reads a decimal amount of c, like "12.5" or "-3.10". It can not
+// have more decimals than the minor unit of c
+func Parse(s string, c Currency) (Money, error) {
+	if !c.Valid() {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, c)
+	}
+
+	exp := c.Exponent()
+	whole, frac, hasFrac := strings.Cut(strings.TrimSpace(s), ".")
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+
+	if !isDigits(whole) || len(frac) > exp || (hasFrac && !isDigits(frac)) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	// the magnitude is read unsigned so -9223372036854775808 fits
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	u, err := strconv.ParseUint(digits, 10, 64)
+	switch {
+	case err != nil, !negative && u > math.MaxInt64, negative && u > -math.MinInt64:
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	amount := int64(u)
+	if negative {
+		amount = -amount
+	}
+	return Money{amount, c}, nil
+}
+
+// isDigits reports whether s is not empty and has only ASCII digits, signs
+// included are rejected
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// add returns a + b and false if it overflows
+func add(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// mul returns a * b and false if it overflows
+func mul(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	return c, c/b == a && (c < 0) == ((a < 0) != (b < 0))
+}
+
+// currency returns the currency of the result of an operation of m and o
+func (m Money) currency(o Money) (Currency, error) {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency, nil
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency, nil
+	default:
+		return "", fmt.Errorf("%w: %s y %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+}
+
+// Add returns m + o, both must have the same currency
+func (m Money) Add(o Money) (Money, error) {
+	c, err := m.currency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	amount, ok := add(m.Amount, o.Amount)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %v + %v", ErrOverflow, m, o)
+	}
+	return Money{amount, c}, nil
+}
+
+// Sub returns m - o, both must have the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: %v - %v", ErrOverflow, m, o)
+	}
+	return m.Add(o.Neg())
+}
+
+// Mul returns m * n
+func (m Money) Mul(n int64) (Money, error) {
+	amount, ok := mul(m.Amount, n)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %v * %d", ErrOverflow, m, n)
+	}
+	return Money{amount, m.Currency}, nil
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{-m.Amount, m.Currency}
+}
+
+// Percent returns the basis points of m (1900 is 19%), rounded half away
+// from zero to the minor unit
+func (m Money) Percent(basisPoints int64) (Money, error) {
+	p, ok := mul(m.Amount, basisPoints)
+	half := int64(5000)
+	if p < 0 {
+		half = -half
+	}
+	if ok {
+		p, ok = add(p, half)
+	}
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %d puntos básicos de %v", ErrOverflow, basisPoints, m)
+	}
+	return Money{p / 10000, m.Currency}, nil
+}
+
+// Cmp compares m and o, both must have the same currency. It returns -1,
+// 0 or 1 when m is less, equal or greater than o
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := m.currency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is less than zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// String formats m with the decimals of its currency, e.g. "12.50 USD"
+func (m Money) String() string {
+	exp := m.Currency.Exponent()
+	sign := ""
+	// the magnitude is unsigned so the one of math.MinInt64 fits
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := strconv.FormatUint(amount, 10)
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+		s = s[:len(s)-exp] + "." + s[len(s)-exp:]
+	}
+
+	if m.Currency == "" {
+		return sign + s
+	}
+	return sign + s + " " + string(m.Currency)
+}
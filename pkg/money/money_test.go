@@ -0,0 +1,184 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency Currency
+		want     Money
+		wantErr  error
+	}{
+		{"12.5", "USD", Money{1250, "USD"}, nil},
+		{"12.50", "USD", Money{1250, "USD"}, nil},
+		{"12", "USD", Money{1200, "USD"}, nil},
+		{" 0.01 ", "USD", Money{1, "USD"}, nil},
+		{"-3.10", "USD", Money{-310, "USD"}, nil},
+		{"-0.5", "EUR", Money{-50, "EUR"}, nil},
+		{"1500", "CLP", Money{1500, "CLP"}, nil},
+		{"1.234", "KWD", Money{1234, "KWD"}, nil},
+		{"1.5", "CLP", Money{}, ErrInvalidAmount},
+		{"1.234", "USD", Money{}, ErrInvalidAmount},
+		{"1.", "USD", Money{}, ErrInvalidAmount},
+		{".5", "USD", Money{}, ErrInvalidAmount},
+		{"+1", "USD", Money{}, ErrInvalidAmount},
+		{"--5", "USD", Money{}, ErrInvalidAmount},
+		{"-+5", "USD", Money{}, ErrInvalidAmount},
+		{"+-5", "USD", Money{}, ErrInvalidAmount},
+		{"5.-1", "USD", Money{}, ErrInvalidAmount},
+		{"5.+1", "USD", Money{}, ErrInvalidAmount},
+		{"- 5", "USD", Money{}, ErrInvalidAmount},
+		{"9223372036854775807", "JPY", Money{math.MaxInt64, "JPY"}, nil},
+		{"-9223372036854775808", "JPY", Money{math.MinInt64, "JPY"}, nil},
+		{"9223372036854775808", "JPY", Money{}, ErrInvalidAmount},
+		{"-9223372036854775809", "JPY", Money{}, ErrInvalidAmount},
+		{"92233720368547758.08", "USD", Money{}, ErrInvalidAmount},
+		{"", "USD", Money{}, ErrInvalidAmount},
+		{"1,5", "USD", Money{}, ErrInvalidAmount},
+		{"abc", "USD", Money{}, ErrInvalidAmount},
+		{"99999999999999999999", "USD", Money{}, ErrInvalidAmount},
+		{"1", "XXX", Money{}, ErrUnknownCurrency},
+		{"1", "", Money{}, ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in+" "+string(tt.currency), func(t *testing.T) {
+			got, err := Parse(tt.in, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		name        string
+		m           Money
+		basisPoints int64
+		want        Money
+	}{
+		{"19%", Money{10000, "USD"}, 1900, Money{1900, "USD"}},
+		{"zero", Money{10000, "USD"}, 0, Money{0, "USD"}},
+		{"round down", Money{104, "USD"}, 1000, Money{10, "USD"}},
+		{"round half up", Money{105, "USD"}, 1000, Money{11, "USD"}},
+		{"negative round half away from zero", Money{-105, "USD"}, 1000, Money{-11, "USD"}},
+		{"negative round down", Money{-104, "USD"}, 1000, Money{-10, "USD"}},
+		{"fraction of basis point", Money{1, "USD"}, 5000, Money{1, "USD"}},
+		{"overflow", Money{math.MaxInt64 / 1000, "USD"}, 1900, Money{}},
+		{"rounding overflow", Money{math.MaxInt64 - 4999, "USD"}, 1, Money{}},
+		{"negative overflow", Money{math.MinInt64 / 1000, "USD"}, 1900, Money{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Percent(tt.basisPoints)
+			if wantErr := tt.want == (Money{}); wantErr != errors.Is(err, ErrOverflow) {
+				t.Fatalf("err = %v, want overflow %v", err, wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Percent(%d) = %+v, want %+v", tt.basisPoints, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Money
+		n       int64
+		want    Money
+		wantErr error
+	}{
+		{"by zero", Money{math.MaxInt64, "USD"}, 0, Money{0, "USD"}, nil},
+		{"negative", Money{-250, "USD"}, 3, Money{-750, "USD"}, nil},
+		{"max", Money{math.MaxInt64, "USD"}, 1, Money{math.MaxInt64, "USD"}, nil},
+		{"overflow", Money{math.MaxInt64/2 + 1, "USD"}, 2, Money{}, ErrOverflow},
+		{"negative overflow", Money{math.MinInt64 / 2, "USD"}, 3, Money{}, ErrOverflow},
+		{"min by minus one", Money{math.MinInt64, "USD"}, -1, Money{}, ErrOverflow},
+		{"minus one by min", Money{-1, "USD"}, math.MinInt64, Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Mul(tt.n)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Mul(%d) = %+v, want %+v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	max, min := Money{math.MaxInt64, "USD"}, Money{math.MinInt64, "USD"}
+	one := Money{1, "USD"}
+
+	if _, err := max.Add(one); !errors.Is(err, ErrOverflow) {
+		t.Errorf("max + 1: err = %v, want %v", err, ErrOverflow)
+	}
+	if _, err := min.Sub(one); !errors.Is(err, ErrOverflow) {
+		t.Errorf("min - 1: err = %v, want %v", err, ErrOverflow)
+	}
+	if _, err := one.Sub(min); !errors.Is(err, ErrOverflow) {
+		t.Errorf("1 - min: err = %v, want %v", err, ErrOverflow)
+	}
+	if got, err := max.Add(min); err != nil || got != (Money{-1, "USD"}) {
+		t.Errorf("max + min = %+v, %v, want -1", got, err)
+	}
+	if _, err := one.Add(Money{1, "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("USD + EUR: err = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if got, err := (Money{}).Add(one); err != nil || got != one {
+		t.Errorf("zero + 1 = %+v, %v, want %+v", got, err, one)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{1250, "USD"}, "12.50 USD"},
+		{Money{5, "USD"}, "0.05 USD"},
+		{Money{0, "USD"}, "0.00 USD"},
+		{Money{-310, "USD"}, "-3.10 USD"},
+		{Money{-5, "EUR"}, "-0.05 EUR"},
+		{Money{1500, "CLP"}, "1500 CLP"},
+		{Money{1234, "KWD"}, "1.234 KWD"},
+		{Money{7, "KWD"}, "0.007 KWD"},
+		{Money{1250, ""}, "12.50"},
+		{Money{math.MinInt64, "JPY"}, "-9223372036854775808 JPY"},
+		{Money{math.MinInt64, "USD"}, "-92233720368547758.08 USD"},
+		{Money{math.MaxInt64, "USD"}, "92233720368547758.07 USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.String(); got != tt.want {
+				t.Errorf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseString checks that String writes what Parse reads
+func TestParseString(t *testing.T) {
+	for _, m := range []Money{{1250, "USD"}, {-1, "EUR"}, {42, "JPY"}, {1001, "BHD"}, {math.MinInt64, "USD"}, {math.MaxInt64, "KWD"}} {
+		amount := m.String()[:len(m.String())-len(m.Currency)-1]
+		got, err := Parse(amount, m.Currency)
+		if err != nil || got != m {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", amount, got, err, m)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"time"
+)
+
+var ErrInvalidListOptions = errors.New("Las opciones de la lista no son válidas")
+
+// Limits of the pages of List, DefaultLimit when the options do not have
+// one and never more than MaxLimit
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Sort is the field that orders List, the ID breaks the ties
+type Sort string
+
+const (
+	SortID        Sort = "id"
+	SortName      Sort = "name"
+	SortPrice     Sort = "price"
+	SortCreatedAt Sort = "created_at"
+)
+
+// Valid reports whether s is a known sort, empty sorts by ID
+func (s Sort) Valid() bool {
+	switch s {
+	case "", SortID, SortName, SortPrice, SortCreatedAt:
+		return true
+	}
+	return false
+}
+
+// ListOptions of List, the zero value of a field does not filter
+type ListOptions struct {
+	// Name is matched as a case insensitive substring
+	Name string
+	// MinPrice and MaxPrice limit the price to [MinPrice, MaxPrice], only
+	// the products in their currency are listed
+	MinPrice *money.Money
+	MaxPrice *money.Money
+	// Sort and Desc order the result, by ID ascending by default
+	Sort Sort
+	Desc bool
+	// Limit is the size of the page. The page starts after the cursor
+	// After (keyset pagination) or skipping Offset products, not both
+	Limit  int
+	Offset int
+	After  *Cursor
+}
+
+// Validate checks that the options can be used by the storages
+func (o ListOptions) Validate() error {
+	switch {
+	case !o.Sort.Valid():
+		return fmt.Errorf("%w: orden %q", ErrInvalidListOptions, o.Sort)
+	case o.Limit < 0 || o.Offset < 0:
+		return fmt.Errorf("%w: limit y offset no pueden ser negativos", ErrInvalidListOptions)
+	case o.After != nil && o.Offset != 0:
+		return fmt.Errorf("%w: after y offset no se pueden usar juntos", ErrInvalidListOptions)
+	}
+
+	for _, p := range []*money.Money{o.MinPrice, o.MaxPrice} {
+		if p != nil && !p.Currency.Valid() {
+			return fmt.Errorf("%w: %v", ErrInvalidListOptions, money.ErrUnknownCurrency)
+		}
+	}
+	if o.MinPrice != nil && o.MaxPrice != nil && o.MinPrice.Currency != o.MaxPrice.Currency {
+		return fmt.Errorf("%w: %v", ErrInvalidListOptions, money.ErrCurrencyMismatch)
+	}
+
+	return nil
+}
+
+// Next returns the cursor of the page that follows ms, the page listed
+// with o. It is nil when ms is the last page
+func (o ListOptions) Next(ms Models) *Cursor {
+	limit := o.Limit
+	switch {
+	case limit <= 0:
+		limit = DefaultLimit
+	case limit > MaxLimit:
+		limit = MaxLimit
+	}
+	if len(ms) < limit {
+		return nil
+	}
+	return CursorOf(ms[len(ms)-1])
+}
+
+// Cursor is the position of a product in a sorted list, a page that
+// starts After it has the products that follow it
+type Cursor struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Price     int64     `json:"price,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// CursorOf returns the cursor of m, it works with every Sort
+func CursorOf(m *Model) *Cursor {
+	return &Cursor{
+		ID:        m.ID,
+		Name:      m.Name,
+		Price:     m.Price.Amount,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// String encodes the cursor as an opaque token that can go in a URL
+func (c *Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a token of Cursor.String
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor %q", ErrInvalidListOptions, s)
+	}
+
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil || c.ID == 0 {
+		return nil, fmt.Errorf("%w: cursor %q", ErrInvalidListOptions, s)
+	}
+	return c, nil
+}
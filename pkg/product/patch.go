@@ -0,0 +1,55 @@
+package product
+
+import (
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/money"
+)
+
+var ErrEmptyPatch = errors.New("El cambio no tiene campos para actualizar")
+
+// Patch has the fields of a product to change, the nil ones are left as
+// they are. Version works like the one of Update
+type Patch struct {
+	Name         *string      `json:"name,omitempty"`
+	Observations *string      `json:"observations,omitempty"`
+	Price        *money.Money `json:"price,omitempty"`
+	Version      uint         `json:"version,omitempty"`
+}
+
+// Empty reports whether the patch does not change any field
+func (p Patch) Empty() bool {
+	return p.Name == nil && p.Observations == nil && p.Price == nil
+}
+
+// Validate checks the fields that are set like Model.Validate, it returns
+// ErrEmptyPatch if there is none
+func (p Patch) Validate() error {
+	if p.Empty() {
+		return ErrEmptyPatch
+	}
+
+	e := &ValidationError{}
+	if p.Name != nil {
+		e.checkName(*p.Name)
+	}
+	if p.Observations != nil {
+		e.checkObservations(*p.Observations)
+	}
+	if p.Price != nil {
+		e.checkPrice(*p.Price)
+	}
+	return e.orNil()
+}
+
+// Apply sets the fields of the patch in m
+func (p Patch) Apply(m *Model) {
+	if p.Name != nil {
+		m.Name = *p.Name
+	}
+	if p.Observations != nil {
+		m.Observations = *p.Observations
+	}
+	if p.Price != nil {
+		m.Price = *p.Price
+	}
+}
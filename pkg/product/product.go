@@ -1,30 +1,179 @@
 package product
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/trace"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 var (
 	ErrIDNotFound = errors.New("El producto no contiene un ID")
+	ErrNotFound   = errors.New("El producto no existe")
+	ErrConflict   = errors.New("El producto ya existe")
+	ErrForeignKey = errors.New("El producto está referenciado por otro registro")
+	ErrValidation = errors.New("El producto no es válido")
+	// ErrStaleVersion is returned by Update when the product changed since
+	// it was read, its Version does not match the stored one
+	ErrStaleVersion = errors.New("El producto fue modificado por otro usuario")
 )
 
+// Error is returned by the storages, every driver maps its errors to it.
+// Kind is ErrNotFound, ErrConflict, ErrForeignKey, ErrValidation or
+// ErrStaleVersion, so
+// errors.Is(err, ErrNotFound) works whatever the db is. Err keeps the error
+// of the driver, if any
+type Error struct {
+	ID   uint
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Kind == ErrNotFound:
+		return fmt.Sprintf("no existe el producto con id: %d", e.ID)
+	case e.Kind == ErrStaleVersion:
+		return fmt.Sprintf("el producto con id %d fue modificado por otro usuario", e.ID)
+	case e.Err == nil:
+		return e.Kind.Error()
+	default:
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	}
+}
+
+// Is reports whether target is the Kind of the error
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Limits of the fields, they are the sizes of the columns of products and
+// storage.Store.VerifySchema fails if the db does not match them
+const (
+	NameMaxLength         = 25
+	ObservationsMaxLength = 100
+)
+
+// FieldError is a field that failed the validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field of the product that failed the
+// validation, errors.Is(err, ErrValidation) is true for it
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		fields = append(fields, f.Field+" "+f.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(fields, ", "))
+}
+
+// Is reports whether target is ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
 // Model of product
 type Model struct {
-	ID           uint
-	Name         string
-	Observations string
-	Price        int
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID           uint        `json:"id"`
+	Name         string      `json:"name"`
+	Observations string      `json:"observations"`
+	Price        money.Money `json:"price"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	// DeletedAt is set when the product is deleted, it is kept so the
+	// invoices can still show it
+	DeletedAt time.Time `json:"deleted_at"`
+	// Version starts at 1 and every change increments it, Update fails
+	// with ErrStaleVersion if it is not the stored one. With 0 it is not
+	// checked
+	Version uint `json:"version"`
+}
+
+// Deleted reports whether the product was deleted
+func (m *Model) Deleted() bool {
+	return !m.DeletedAt.IsZero()
+}
+
+// includeDeletedKey of the context value of WithDeleted
+type includeDeletedKey struct{}
+
+// WithDeleted returns a context that makes the storages read the deleted
+// products too, by default GetAll, List, Each and GetByID skip them
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// IncludeDeleted reports whether ctx comes from WithDeleted
+func IncludeDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
 }
 
 func (m *Model) String() string {
-	return fmt.Sprintf("%02d | %-20s | %-20s | %5d | %10s | %10s",
+	return fmt.Sprintf("%02d | %-20s | %-20s | %12s | %10s | %10s | %7d",
 		m.ID, m.Name, m.Observations, m.Price,
-		m.CreatedAt.Format("2006-01-02"), m.UpdatedAt.Format("2006-01-02"))
+		m.CreatedAt.Format("2006-01-02"), m.UpdatedAt.Format("2006-01-02"), m.Version)
+}
+
+// Validate checks the fields of the product, it returns a
+// *ValidationError with all the fields that are not valid
+func (m *Model) Validate() error {
+	e := &ValidationError{}
+	e.checkName(m.Name)
+	e.checkObservations(m.Observations)
+	e.checkPrice(m.Price)
+	return e.orNil()
+}
+
+func (e *ValidationError) add(field, format string, a ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{field, fmt.Sprintf(format, a...)})
+}
+
+func (e *ValidationError) checkName(name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		e.add("name", "es obligatorio")
+	case utf8.RuneCountInString(name) > NameMaxLength:
+		e.add("name", "supera los %d caracteres", NameMaxLength)
+	}
+}
+
+func (e *ValidationError) checkObservations(observations string) {
+	if utf8.RuneCountInString(observations) > ObservationsMaxLength {
+		e.add("observations", "supera los %d caracteres", ObservationsMaxLength)
+	}
+}
+
+func (e *ValidationError) checkPrice(price money.Money) {
+	if price.IsNegative() {
+		e.add("price", "no puede ser negativo")
+	}
+	if !price.Currency.Valid() {
+		e.add("price", "la moneda %q no es válida", price.Currency)
+	}
+}
+
+// orNil returns e if it has fields
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
 }
 
 // Models slice of Model
@@ -32,8 +181,8 @@ type Models []*Model
 
 func (m Models) String() string {
 	builder := strings.Builder{}
-	builder.WriteString(fmt.Sprintf("%02s | %-20s | %-20s | %5s | %10s | %10s\n",
-		"id", "name", "observations", "price", "created_at", "updated_at"))
+	builder.WriteString(fmt.Sprintf("%02s | %-20s | %-20s | %12s | %10s | %10s | %7s\n",
+		"id", "name", "observations", "price", "created_at", "updated_at", "version"))
 	for _, model := range m {
 		builder.WriteString(model.String() + "\n")
 	}
@@ -41,55 +190,195 @@ func (m Models) String() string {
 }
 
 type Storage interface {
-	Migrate() error
-	Create(*Model) error
-	GetAll() (Models, error)
-	GetByID(uint) (*Model, error)
-	Update(*Model) error
-	Delete(uint) error
+	Migrate(context.Context) error
+	Create(context.Context, *Model) error
+	GetAll(context.Context) (Models, error)
+	List(context.Context, ListOptions) (Models, error)
+	// Each calls fn with every product ordered by ID, reading them one by
+	// one from the db. An error of fn stops it and Each returns it
+	Each(ctx context.Context, fn func(*Model) error) error
+	GetByID(context.Context, uint) (*Model, error)
+	// Update and Delete fail with ErrNotFound if the product is deleted,
+	// Delete only sets DeletedAt and Restore clears it, failing with
+	// ErrNotFound if the product is not deleted. Update checks the Version
+	// of the model and increments it
+	Update(context.Context, *Model) error
+	// Patch changes only the fields set in the patch, like Update
+	Patch(ctx context.Context, id uint, p Patch) error
+	Delete(context.Context, uint) error
+	Restore(context.Context, uint) error
 }
 
 // Service of product
 type Service struct {
 	storage Storage
+	tracer  *trace.Tracer
+}
+
+// Option configures the Service
+type Option func(*Service)
+
+// WithTracer makes the service start a span per operation, the spans of
+// the storage are its children
+func WithTracer(t *trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = t
+	}
 }
 
 // NewService returns a pointer of Service
-func NewService(s Storage) *Service {
-	return &Service{s}
+func NewService(s Storage, opts ...Option) *Service {
+	service := &Service{storage: s}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
+}
+
+// MigrateContext is used to migrate product
+func (s *Service) MigrateContext(ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Migrate")
+	defer func() { span.End(err) }()
+	return s.storage.Migrate(ctx)
+}
+
+// CreateContext is used to create product, it is validated first
+func (s *Service) CreateContext(ctx context.Context, m *Model) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Create")
+	defer func() { span.End(err) }()
+
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	m.CreatedAt = time.Now()
+	return s.storage.Create(ctx, m)
+}
+
+// GetAllContext is used to get all products
+func (s *Service) GetAllContext(ctx context.Context) (_ Models, err error) {
+	ctx, span := s.tracer.Start(ctx, "product.GetAll")
+	defer func() { span.End(err) }()
+	return s.storage.GetAll(ctx)
+}
+
+// ListContext is used to get a page of products, see ListOptions
+func (s *Service) ListContext(ctx context.Context, o ListOptions) (_ Models, err error) {
+	ctx, span := s.tracer.Start(ctx, "product.List")
+	defer func() { span.End(err) }()
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return s.storage.List(ctx, o)
+}
+
+// EachContext is used to go through all the products without loading
+// them at once, see Storage.Each
+func (s *Service) EachContext(ctx context.Context, fn func(*Model) error) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Each")
+	defer func() { span.End(err) }()
+	return s.storage.Each(ctx, fn)
+}
+
+// GetByIDContext is used to get a single product
+func (s *Service) GetByIDContext(ctx context.Context, id uint) (_ *Model, err error) {
+	ctx, span := s.tracer.Start(ctx, "product.GetByID")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("product.id", id)
+	return s.storage.GetByID(ctx, id)
+}
+
+// UpdateContext is used to update a product, it is validated first
+func (s *Service) UpdateContext(ctx context.Context, m *Model) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Update")
+	defer func() { span.End(err) }()
+
+	if m.ID == 0 {
+		return ErrIDNotFound
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	m.UpdatedAt = time.Now()
+	return s.storage.Update(ctx, m)
+}
+
+// PatchContext is used to change only some fields of a product, it is
+// validated first. It returns the product as it was saved
+func (s *Service) PatchContext(ctx context.Context, id uint, p Patch) (_ *Model, err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Patch")
+	defer func() { span.End(err) }()
+	span.SetAttributes("product.id", id)
+
+	if id == 0 {
+		return nil, ErrIDNotFound
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.storage.Patch(ctx, id, p); err != nil {
+		return nil, err
+	}
+	return s.storage.GetByID(ctx, id)
+}
+
+// DeleteContext is used to delete a product, it can be restored
+func (s *Service) DeleteContext(ctx context.Context, id uint) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Delete")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("product.id", id)
+	return s.storage.Delete(ctx, id)
+}
+
+// RestoreContext is used to restore a deleted product
+func (s *Service) RestoreContext(ctx context.Context, id uint) (err error) {
+	ctx, span := s.tracer.Start(ctx, "product.Restore")
+	defer func() { span.End(err) }()
+
+	span.SetAttributes("product.id", id)
+	return s.storage.Restore(ctx, id)
 }
 
 // Migrate is used to migrate product
+//
+// Deprecated: use MigrateContext
 func (s *Service) Migrate() error {
-	return s.storage.Migrate()
+	return s.MigrateContext(context.Background())
 }
 
 // Create is used to create product
+//
+// Deprecated: use CreateContext
 func (s *Service) Create(m *Model) error {
-	m.CreatedAt = time.Now()
-	return s.storage.Create(m)
+	return s.CreateContext(context.Background(), m)
 }
 
 // GetAll is used to get all products
+//
+// Deprecated: use GetAllContext
 func (s *Service) GetAll() (Models, error) {
-	return s.storage.GetAll()
+	return s.GetAllContext(context.Background())
 }
 
 // GetByID is used to get a single product
+//
+// Deprecated: use GetByIDContext
 func (s *Service) GetByID(id uint) (*Model, error) {
-	return s.storage.GetByID(id)
+	return s.GetByIDContext(context.Background(), id)
 }
 
 // Update is used to update a product
+//
+// Deprecated: use UpdateContext
 func (s *Service) Update(m *Model) error {
-	if m.ID == 0 {
-		return ErrIDNotFound
-	}
-	m.UpdatedAt = time.Now()
-	return s.storage.Update(m)
+	return s.UpdateContext(context.Background(), m)
 }
 
 // Delete is used to delete a product
+//
+// Deprecated: use DeleteContext
 func (s *Service) Delete(id uint) error {
-	return s.storage.Delete(id)
+	return s.DeleteContext(context.Background(), id)
 }
@@ -0,0 +1,174 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	free := money.New(0, "USD")
+	tests := []struct {
+		name string
+		m    product.Model
+		// wantFields are the fields that fail, in order
+		wantFields []string
+	}{
+		{name: "ok", m: product.Model{Name: "lápiz", Price: money.New(1000, "USD")}},
+		{name: "free", m: product.Model{Name: "lápiz", Price: money.New(0, "CLP")}},
+		{name: "name at the limit", m: product.Model{Name: strings.Repeat("ñ", product.NameMaxLength), Price: free}},
+		{name: "name over the limit", m: product.Model{Name: strings.Repeat("ñ", product.NameMaxLength+1), Price: free}, wantFields: []string{"name"}},
+		{name: "empty name", m: product.Model{Price: free}, wantFields: []string{"name"}},
+		{name: "blank name", m: product.Model{Name: " \t", Price: free}, wantFields: []string{"name"}},
+		{
+			name: "observations at the limit",
+			m:    product.Model{Name: "lápiz", Observations: strings.Repeat("é", product.ObservationsMaxLength), Price: free},
+		},
+		{
+			name:       "observations over the limit",
+			m:          product.Model{Name: "lápiz", Observations: strings.Repeat("é", product.ObservationsMaxLength+1), Price: free},
+			wantFields: []string{"observations"},
+		},
+		{name: "negative price", m: product.Model{Name: "lápiz", Price: money.New(-1, "USD")}, wantFields: []string{"price"}},
+		{name: "without currency", m: product.Model{Name: "lápiz", Price: money.Money{Amount: 1000}}, wantFields: []string{"price"}},
+		{name: "unknown currency", m: product.Model{Name: "lápiz", Price: money.New(1000, "XXX")}, wantFields: []string{"price"}},
+		{
+			name:       "every field",
+			m:          product.Model{Observations: strings.Repeat("x", product.ObservationsMaxLength+1), Price: money.New(-1, "USD")},
+			wantFields: []string{"name", "observations", "price"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.Validate()
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+
+			var ve *product.ValidationError
+			if !errors.As(err, &ve) || !errors.Is(err, product.ErrValidation) {
+				t.Fatalf("err = %v, want a *ValidationError", err)
+			}
+			fields := make([]string, 0, len(ve.Fields))
+			for _, f := range ve.Fields {
+				fields = append(fields, f.Field)
+				if f.Message == "" {
+					t.Errorf("field %s without message", f.Field)
+				}
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// TestServiceValidates checks that invalid products do not reach the
+// storage
+func TestServiceValidates(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewMemoryDB()
+	service := product.NewService(storage.NewMemoryProduct(db))
+
+	if err := service.CreateContext(ctx, &product.Model{Price: money.New(-1, "USD")}); !errors.Is(err, product.ErrValidation) {
+		t.Errorf("CreateContext: err = %v, want %v", err, product.ErrValidation)
+	}
+
+	m := &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}
+	if err := service.CreateContext(ctx, m); err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	if err := service.UpdateContext(ctx, &product.Model{ID: m.ID, Name: strings.Repeat("x", product.NameMaxLength+1)}); !errors.Is(err, product.ErrValidation) {
+		t.Errorf("UpdateContext: err = %v, want %v", err, product.ErrValidation)
+	}
+
+	ms, err := service.GetAllContext(ctx)
+	if err != nil {
+		t.Fatalf("GetAllContext: %v", err)
+	}
+	if len(ms) != 1 || ms[0].Name != "lápiz" {
+		t.Errorf("products = %v, want only the valid one unchanged", ms)
+	}
+}
+
+func TestPatchValidate(t *testing.T) {
+	name, empty, long := "borrador", "", strings.Repeat("x", product.NameMaxLength+1)
+	price, negative := money.New(100, "USD"), money.New(-1, "USD")
+
+	tests := []struct {
+		name       string
+		p          product.Patch
+		wantErr    error
+		wantFields []string
+	}{
+		{name: "name", p: product.Patch{Name: &name}},
+		{name: "price", p: product.Patch{Price: &price}},
+		{name: "clear observations", p: product.Patch{Observations: &empty}},
+		{name: "empty", p: product.Patch{Version: 2}, wantErr: product.ErrEmptyPatch},
+		{name: "empty name", p: product.Patch{Name: &empty}, wantErr: product.ErrValidation, wantFields: []string{"name"}},
+		{
+			name:       "only the fields that are set",
+			p:          product.Patch{Name: &long, Price: &negative},
+			wantErr:    product.ErrValidation,
+			wantFields: []string{"name", "price"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var ve *product.ValidationError
+			if !errors.As(err, &ve) {
+				return
+			}
+			fields := make([]string, 0, len(ve.Fields))
+			for _, f := range ve.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// TestServicePatch checks that PatchContext keeps the fields that are not
+// set and returns the product as it was saved
+func TestServicePatch(t *testing.T) {
+	ctx := context.Background()
+	service := product.NewService(storage.NewMemoryProduct(storage.NewMemoryDB()))
+
+	m := &product.Model{Name: "lápiz", Observations: "HB", Price: money.New(1000, "USD")}
+	if err := service.CreateContext(ctx, m); err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+
+	price := money.New(1200, "USD")
+	got, err := service.PatchContext(ctx, m.ID, product.Patch{Price: &price, Version: m.Version})
+	if err != nil {
+		t.Fatalf("PatchContext: %v", err)
+	}
+	if got.Name != "lápiz" || got.Observations != "HB" || got.Price != price || got.Version != m.Version+1 {
+		t.Errorf("PatchContext = %+v, want lápiz HB of 12.00 USD version %d", got, m.Version+1)
+	}
+
+	if _, err := service.PatchContext(ctx, 0, product.Patch{Price: &price}); !errors.Is(err, product.ErrIDNotFound) {
+		t.Errorf("PatchContext without id: err = %v, want %v", err, product.ErrIDNotFound)
+	}
+	if _, err := service.PatchContext(ctx, m.ID, product.Patch{Price: &money.Money{Amount: 1}}); !errors.Is(err, product.ErrValidation) {
+		t.Errorf("PatchContext invalid: err = %v, want %v", err, product.ErrValidation)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strconv"
+	"strings"
+)
+
+// itemProductFK is the foreign key of invoice_items to products
+const itemProductFK = "invoice_items_product_id_fk"
+
+// errorKind returns the sentinel error of product that matches the error
+// of the driver, nil if there is none
+func errorKind(err error) error {
+	var pqErr *pq.Error
+	var mysqlErr *mysql.MySQLError
+	var sqliteErr *sqlite.Error
+
+	switch {
+	case errors.As(err, &pqErr):
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return product.ErrConflict
+		case "foreign_key_violation":
+			return product.ErrForeignKey
+		case "not_null_violation", "check_violation",
+			"string_data_right_truncation", "numeric_value_out_of_range":
+			return product.ErrValidation
+		}
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		// ER_DUP_ENTRY
+		case 1062:
+			return product.ErrConflict
+		// ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		case 1451, 1452:
+			return product.ErrForeignKey
+		// ER_BAD_NULL_ERROR, ER_WARN_DATA_OUT_OF_RANGE, ER_DATA_TOO_LONG,
+		// ER_CHECK_CONSTRAINT_VIOLATED
+		case 1048, 1264, 1406, 3819:
+			return product.ErrValidation
+		}
+	case errors.As(err, &sqliteErr):
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return product.ErrConflict
+		// ON DELETE RESTRICT is reported as a trigger constraint
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+			return product.ErrForeignKey
+		case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+			return product.ErrValidation
+		}
+	}
+
+	return nil
+}
+
+// productError maps the errors of the drivers to *product.Error, the
+// other errors are returned as they are
+func productError(id uint, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return &product.Error{ID: id, Kind: product.ErrNotFound, Err: err}
+	}
+	if kind := errorKind(err); kind != nil {
+		return &product.Error{ID: id, Kind: kind, Err: err}
+	}
+	return err
+}
+
+// itemProductError maps the violation of itemProductFK to a *product.Error
+// of kind ErrForeignKey with the id of the missing product, the other
+// errors, even the ones of other foreign keys, are returned as they are.
+// SQLite does not name the foreign key that failed, see sqliteItemError
+func itemProductError(productID uint, err error) error {
+	var pqErr *pq.Error
+	var mysqlErr *mysql.MySQLError
+
+	switch {
+	case errors.As(err, &pqErr):
+		if pqErr.Code.Name() != "foreign_key_violation" || pqErr.Constraint != itemProductFK {
+			return err
+		}
+	case errors.As(err, &mysqlErr):
+		// ER_NO_REFERENCED_ROW_2 names the constraint only in the message
+		if mysqlErr.Number != 1452 || !strings.Contains(mysqlErr.Message, "`"+itemProductFK+"`") {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return &product.Error{ID: productID, Kind: product.ErrForeignKey, Err: err}
+}
+
+// pqMissingProductID reads the id of the missing product from the detail of
+// a foreign key violation of postgres, `Key (product_id)=(9) is not present
+// in table "products".`, 0 if err is not one
+func pqMissingProductID(err error) uint {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return 0
+	}
+
+	detail := strings.TrimPrefix(pqErr.Detail, "Key (product_id)=(")
+	if detail == pqErr.Detail {
+		return 0
+	}
+	if i := strings.IndexByte(detail, ')'); i >= 0 {
+		detail = detail[:i]
+	}
+
+	id, err := strconv.ParseUint(detail, 10, 0)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+func productNotFound(id uint) error {
+	return &product.Error{ID: id, Kind: product.ErrNotFound}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"testing"
+)
+
+// sqliteErrors returns the errors of SQLite for a unique, a foreign key, a
+// not null and a check violation, in that order
+func sqliteErrors(t *testing.T) []error {
+	t.Helper()
+
+	db := sqliteDB(t)
+	if _, err := db.Exec(`CREATE TABLE t(
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		n INT CHECK (n > 0),
+		product_id INT REFERENCES products (id)
+	)`); err != nil {
+		t.Fatalf("CREATE TABLE: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO t(name) VALUES ('a')`); err != nil {
+		t.Fatalf("INSERT: %v", err)
+	}
+
+	errs := make([]error, 0, 4)
+	for _, stmt := range []string{
+		`INSERT INTO t(name) VALUES ('a')`,
+		`INSERT INTO t(name, product_id) VALUES ('b', 9)`,
+		`INSERT INTO t(name) VALUES (NULL)`,
+		`INSERT INTO t(name, n) VALUES ('b', 0)`,
+	} {
+		_, err := db.Exec(stmt)
+		if err == nil {
+			t.Fatalf("%s did not fail", stmt)
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func TestErrorKind(t *testing.T) {
+	sqliteErrs := sqliteErrors(t)
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "pq unique", err: &pq.Error{Code: "23505"}, want: product.ErrConflict},
+		{name: "pq foreign key", err: &pq.Error{Code: "23503"}, want: product.ErrForeignKey},
+		{name: "pq not null", err: &pq.Error{Code: "23502"}, want: product.ErrValidation},
+		{name: "pq check", err: &pq.Error{Code: "23514"}, want: product.ErrValidation},
+		{name: "pq too long", err: &pq.Error{Code: "22001"}, want: product.ErrValidation},
+		{name: "pq syntax", err: &pq.Error{Code: "42601"}},
+		{name: "mysql duplicated", err: &mysql.MySQLError{Number: 1062}, want: product.ErrConflict},
+		{name: "mysql referenced", err: &mysql.MySQLError{Number: 1451}, want: product.ErrForeignKey},
+		{name: "mysql no referenced", err: &mysql.MySQLError{Number: 1452}, want: product.ErrForeignKey},
+		{name: "mysql null", err: &mysql.MySQLError{Number: 1048}, want: product.ErrValidation},
+		{name: "mysql too long", err: &mysql.MySQLError{Number: 1406}, want: product.ErrValidation},
+		{name: "mysql lock wait", err: &mysql.MySQLError{Number: 1205}},
+		{name: "sqlite unique", err: sqliteErrs[0], want: product.ErrConflict},
+		{name: "sqlite foreign key", err: sqliteErrs[1], want: product.ErrForeignKey},
+		{name: "sqlite not null", err: sqliteErrs[2], want: product.ErrValidation},
+		{name: "sqlite check", err: sqliteErrs[3], want: product.ErrValidation},
+		{name: "wrapped", err: fmt.Errorf("create: %w", &pq.Error{Code: "23505"}), want: product.ErrConflict},
+		{name: "other", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorKind(tt.err); got != tt.want {
+				t.Errorf("errorKind(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemProductError(t *testing.T) {
+	productFK := "Cannot add or update a child row: a foreign key constraint fails " +
+		"(`godb`.`invoice_items`, CONSTRAINT `invoice_items_product_id_fk` FOREIGN KEY (`product_id`) REFERENCES `products` (`id`))"
+	headerFK := "Cannot add or update a child row: a foreign key constraint fails " +
+		"(`godb`.`invoice_items`, CONSTRAINT `invoice_items_invoice_header_id_fk` FOREIGN KEY (`invoice_header_id`) REFERENCES `invoice_headers` (`id`))"
+
+	tests := []struct {
+		name   string
+		err    error
+		wantFK bool
+	}{
+		{name: "pq product", err: &pq.Error{Code: "23503", Constraint: itemProductFK}, wantFK: true},
+		{name: "pq header", err: &pq.Error{Code: "23503", Constraint: "invoice_items_invoice_header_id_fk"}},
+		{name: "pq unique", err: &pq.Error{Code: "23505", Constraint: itemProductFK}},
+		{name: "mysql product", err: &mysql.MySQLError{Number: 1452, Message: productFK}, wantFK: true},
+		{name: "mysql header", err: &mysql.MySQLError{Number: 1452, Message: headerFK}},
+		{name: "mysql referenced", err: &mysql.MySQLError{Number: 1451, Message: productFK}},
+		{name: "other", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := itemProductError(7, tt.err)
+
+			var pErr *product.Error
+			if !tt.wantFK {
+				if err != tt.err {
+					t.Errorf("err = %v, want it unwrapped", err)
+				}
+				return
+			}
+			if !errors.As(err, &pErr) || pErr.ID != 7 || !errors.Is(err, product.ErrForeignKey) {
+				t.Errorf("err = %#v, want the product 7 of kind ErrForeignKey", err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPqMissingProductID(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want uint
+	}{
+		{name: "product", err: &pq.Error{Code: "23503", Detail: `Key (product_id)=(9) is not present in table "products".`}, want: 9},
+		{name: "header", err: &pq.Error{Code: "23503", Detail: `Key (invoice_header_id)=(9) is not present in table "invoice_headers".`}},
+		{name: "without detail", err: &pq.Error{Code: "23503"}},
+		{name: "other", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pqMissingProductID(tt.err); got != tt.want {
+				t.Errorf("pqMissingProductID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestItemMissingProduct checks that the memory and SQLite storages report
+// a missing product of an item with its id, and the other foreign keys as
+// they are
+func TestItemMissingProduct(t *testing.T) {
+	ctx := context.Background()
+
+	sqlite := sqliteDB(t)
+	memory := memoryDB(t)
+	storages := map[string]invoice.Storage{
+		"memory": NewMemoryInvoice(memory),
+		"sqlite": NewSQLiteInvoice(sqlite, NewSQLiteInvoiceHeader(sqlite), NewSQLiteInvoiceItem(sqlite)),
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			m := &invoice.Model{
+				Header: &invoiceheader.Model{Client: "Alexys"},
+				Items:  invoiceitem.Models{{ProductID: 1}, {ProductID: 9}},
+			}
+
+			err := s.Create(ctx, m)
+			var pErr *product.Error
+			if !errors.As(err, &pErr) || pErr.ID != 9 || !errors.Is(err, product.ErrForeignKey) {
+				t.Errorf("err = %v, want the product 9 of kind ErrForeignKey", err)
+			}
+		})
+	}
+
+	t.Run("sqlite missing header", func(t *testing.T) {
+		tx, err := sqlite.Begin()
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		defer tx.Rollback()
+
+		err = NewSQLiteInvoiceItem(sqlite).CreateTx(ctx, tx, 99, invoiceitem.Models{{ProductID: 1}})
+		if err == nil || errors.Is(err, product.ErrForeignKey) {
+			t.Errorf("err = %v, want the error of the driver", err)
+		}
+	})
+}
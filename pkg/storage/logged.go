@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+)
+
+// loggedProduct reports the operations of a product.Storage
+type loggedProduct struct {
+	next product.Storage
+	events
+}
+
+// Migrate implements interface product.Storage
+func (l *loggedProduct) Migrate(ctx context.Context) error {
+	ctx, op := l.begin(ctx, "migrate")
+	err := l.next.Migrate(ctx)
+	op.end(true, 0, err)
+	return err
+}
+
+// Create implements interface product.Storage
+func (l *loggedProduct) Create(ctx context.Context, m *product.Model) error {
+	ctx, op := l.begin(ctx, "create")
+	err := l.next.Create(ctx, m)
+	op.end(true, m.ID, err)
+	return err
+}
+
+// GetAll implements interface product.Storage
+func (l *loggedProduct) GetAll(ctx context.Context) (product.Models, error) {
+	ctx, op := l.begin(ctx, "get_all")
+	ms, err := l.next.GetAll(ctx)
+	op.end(false, 0, err, "rows", len(ms))
+	return ms, err
+}
+
+// List implements interface product.Storage
+func (l *loggedProduct) List(ctx context.Context, o product.ListOptions) (product.Models, error) {
+	ctx, op := l.begin(ctx, "list")
+	ms, err := l.next.List(ctx, o)
+	op.end(false, 0, err, "rows", len(ms))
+	return ms, err
+}
+
+// Each implements interface product.Storage
+func (l *loggedProduct) Each(ctx context.Context, fn func(*product.Model) error) error {
+	ctx, op := l.begin(ctx, "each")
+	rows := 0
+	err := l.next.Each(ctx, func(m *product.Model) error {
+		rows++
+		return fn(m)
+	})
+	op.end(false, 0, err, "rows", rows)
+	return err
+}
+
+// GetByID implements interface product.Storage
+func (l *loggedProduct) GetByID(ctx context.Context, id uint) (*product.Model, error) {
+	ctx, op := l.begin(ctx, "get")
+	m, err := l.next.GetByID(ctx, id)
+	op.end(false, id, err)
+	return m, err
+}
+
+// Update implements interface product.Storage
+func (l *loggedProduct) Update(ctx context.Context, m *product.Model) error {
+	ctx, op := l.begin(ctx, "update")
+	err := l.next.Update(ctx, m)
+	op.end(true, m.ID, err)
+	return err
+}
+
+// Patch implements interface product.Storage
+func (l *loggedProduct) Patch(ctx context.Context, id uint, p product.Patch) error {
+	ctx, op := l.begin(ctx, "patch")
+	err := l.next.Patch(ctx, id, p)
+	op.end(true, id, err)
+	return err
+}
+
+// Delete implements interface product.Storage
+func (l *loggedProduct) Delete(ctx context.Context, id uint) error {
+	ctx, op := l.begin(ctx, "delete")
+	err := l.next.Delete(ctx, id)
+	op.end(true, id, err)
+	return err
+}
+
+// Restore implements interface product.Storage
+func (l *loggedProduct) Restore(ctx context.Context, id uint) error {
+	ctx, op := l.begin(ctx, "restore")
+	err := l.next.Restore(ctx, id)
+	op.end(true, id, err)
+	return err
+}
+
+// loggedInvoiceHeader reports the operations of an invoiceheader.Storage
+type loggedInvoiceHeader struct {
+	next invoiceheader.Storage
+	events
+}
+
+// Migrate implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) Migrate(ctx context.Context) error {
+	ctx, op := l.begin(ctx, "migrate")
+	err := l.next.Migrate(ctx)
+	op.end(true, 0, err)
+	return err
+}
+
+// CreateTx implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) CreateTx(ctx context.Context, tx *sql.Tx, m *invoiceheader.Model) error {
+	ctx, op := l.begin(ctx, "create")
+	err := l.next.CreateTx(ctx, tx, m)
+	op.end(true, m.ID, err)
+	return err
+}
+
+// GetByID implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) GetByID(ctx context.Context, id uint) (*invoiceheader.Model, error) {
+	ctx, op := l.begin(ctx, "get")
+	m, err := l.next.GetByID(ctx, id)
+	op.end(false, id, err)
+	return m, err
+}
+
+// List implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) List(ctx context.Context, f invoiceheader.Filter) (invoiceheader.Models, error) {
+	ctx, op := l.begin(ctx, "list")
+	ms, err := l.next.List(ctx, f)
+	op.end(false, 0, err, "rows", len(ms))
+	return ms, err
+}
+
+// ChangeStatusTx implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) ChangeStatusTx(ctx context.Context, tx *sql.Tx, c *invoiceheader.StatusChange) error {
+	ctx, op := l.begin(ctx, "change_status")
+	err := l.next.ChangeStatusTx(ctx, tx, c)
+	op.end(true, c.InvoiceHeaderID, err, "from", c.From, "to", c.To)
+	return err
+}
+
+// StatusHistory implements interface invoiceheader.Storage
+func (l *loggedInvoiceHeader) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	ctx, op := l.begin(ctx, "status_history")
+	cs, err := l.next.StatusHistory(ctx, id)
+	op.end(false, id, err, "rows", len(cs))
+	return cs, err
+}
+
+// loggedInvoiceItem reports the operations of an invoiceitem.Storage, the
+// id of the events is the one of the header
+type loggedInvoiceItem struct {
+	next invoiceitem.Storage
+	events
+}
+
+// Migrate implements interface invoiceitem.Storage
+func (l *loggedInvoiceItem) Migrate(ctx context.Context) error {
+	ctx, op := l.begin(ctx, "migrate")
+	err := l.next.Migrate(ctx)
+	op.end(true, 0, err)
+	return err
+}
+
+// CreateTx implements interface invoiceitem.Storage
+func (l *loggedInvoiceItem) CreateTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	ctx, op := l.begin(ctx, "create")
+	err := l.next.CreateTx(ctx, tx, headerID, ms)
+	op.end(true, headerID, err, "rows", len(ms))
+	return err
+}
+
+// GetByHeaderID implements interface invoiceitem.Storage
+func (l *loggedInvoiceItem) GetByHeaderID(ctx context.Context, headerID uint) (invoiceitem.Models, error) {
+	ctx, op := l.begin(ctx, "get_by_header")
+	ms, err := l.next.GetByHeaderID(ctx, headerID)
+	op.end(false, headerID, err, "rows", len(ms))
+	return ms, err
+}
+
+// GetByHeaderIDs implements interface invoiceitem.Storage
+func (l *loggedInvoiceItem) GetByHeaderIDs(ctx context.Context, headerIDs []uint) (invoiceitem.Models, error) {
+	ctx, op := l.begin(ctx, "get_by_headers")
+	ms, err := l.next.GetByHeaderIDs(ctx, headerIDs)
+	op.end(false, 0, err, "headers", len(headerIDs), "rows", len(ms))
+	return ms, err
+}
+
+// loggedInvoice reports the operations of an invoice.Storage, the id of
+// the events is the one of the header
+type loggedInvoice struct {
+	next invoice.Storage
+	events
+}
+
+// Create implements interface invoice.Storage
+func (l *loggedInvoice) Create(ctx context.Context, m *invoice.Model) error {
+	ctx, op := l.begin(ctx, "create")
+	err := l.next.Create(ctx, m)
+	// an invoice without header fails before it has an id
+	var id uint
+	if m.Header != nil {
+		id = m.Header.ID
+	}
+	op.end(true, id, err, "items", len(m.Items))
+	return err
+}
+
+// GetByID implements interface invoice.Storage
+func (l *loggedInvoice) GetByID(ctx context.Context, id uint) (*invoice.Model, error) {
+	ctx, op := l.begin(ctx, "get")
+	m, err := l.next.GetByID(ctx, id)
+	op.end(false, id, err)
+	return m, err
+}
+
+// List implements interface invoice.Storage
+func (l *loggedInvoice) List(ctx context.Context, f invoiceheader.Filter) (invoice.Models, error) {
+	ctx, op := l.begin(ctx, "list")
+	ms, err := l.next.List(ctx, f)
+	op.end(false, 0, err, "rows", len(ms))
+	return ms, err
+}
+
+// ChangeStatus implements interface invoice.Storage
+func (l *loggedInvoice) ChangeStatus(ctx context.Context, c *invoiceheader.StatusChange) error {
+	ctx, op := l.begin(ctx, "change_status")
+	err := l.next.ChangeStatus(ctx, c)
+	op.end(true, c.InvoiceHeaderID, err, "from", c.From, "to", c.To)
+	return err
+}
+
+// Cancel implements interface invoice.Storage
+func (l *loggedInvoice) Cancel(ctx context.Context, c *invoiceheader.StatusChange, creditNote *invoice.Model) error {
+	ctx, op := l.begin(ctx, "cancel")
+	err := l.next.Cancel(ctx, c, creditNote)
+	args := []interface{}{"from", c.From, "to", c.To}
+	if creditNote != nil && creditNote.Header != nil {
+		args = append(args, "credit_note_id", creditNote.Header.ID)
+	}
+	op.end(true, c.InvoiceHeaderID, err, args...)
+	return err
+}
+
+// StatusHistory implements interface invoice.Storage
+func (l *loggedInvoice) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	ctx, op := l.begin(ctx, "status_history")
+	cs, err := l.next.StatusHistory(ctx, id)
+	op.end(false, id, err, "rows", len(cs))
+	return cs, err
+}
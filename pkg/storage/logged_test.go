@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"testing"
+	"time"
+)
+
+// logEntry is an event received by testLogger
+type logEntry struct {
+	level string
+	msg   string
+	attrs map[string]interface{}
+}
+
+// testLogger keeps the events of the storages
+type testLogger struct {
+	entries []logEntry
+}
+
+func (l *testLogger) add(level, msg string, args []interface{}) {
+	e := logEntry{level: level, msg: msg, attrs: make(map[string]interface{})}
+	for i := 0; i+1 < len(args); i += 2 {
+		e.attrs[args[i].(string)] = args[i+1]
+	}
+	l.entries = append(l.entries, e)
+}
+
+func (l *testLogger) DebugContext(_ context.Context, msg string, args ...interface{}) {
+	l.add("debug", msg, args)
+}
+
+func (l *testLogger) InfoContext(_ context.Context, msg string, args ...interface{}) {
+	l.add("info", msg, args)
+}
+
+func (l *testLogger) ErrorContext(_ context.Context, msg string, args ...interface{}) {
+	l.add("error", msg, args)
+}
+
+// last returns the last event, it fails if there is none
+func (l *testLogger) last(t *testing.T) logEntry {
+	t.Helper()
+	if len(l.entries) == 0 {
+		t.Fatal("no events")
+	}
+	return l.entries[len(l.entries)-1]
+}
+
+func TestLoggedProduct(t *testing.T) {
+	ctx := context.Background()
+	log := &testLogger{}
+	s, err := Open(Config{Driver: Memory}, WithLogger(log))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	m := &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}
+	if err := s.Product().Create(ctx, m); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	e := log.last(t)
+	if e.level != "info" || e.msg != "storage" || e.attrs["operation"] != "create" || e.attrs["table"] != "products" ||
+		e.attrs["driver"] != string(Memory) || e.attrs["id"] != m.ID {
+		t.Errorf("create event = %+v", e)
+	}
+	if _, ok := e.attrs["duration"].(time.Duration); !ok {
+		t.Errorf("create event without duration: %+v", e)
+	}
+
+	if _, err := s.Product().GetAll(ctx); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if e := log.last(t); e.level != "debug" || e.attrs["operation"] != "get_all" || e.attrs["rows"] != 1 {
+		t.Errorf("get_all event = %+v", e)
+	}
+
+	_, err = s.Product().GetByID(ctx, 9)
+	if !errors.Is(err, product.ErrNotFound) {
+		t.Fatalf("GetByID: err = %v, want %v", err, product.ErrNotFound)
+	}
+	if e := log.last(t); e.level != "error" || e.attrs["id"] != uint(9) || e.attrs["error"] != err.Error() {
+		t.Errorf("get event = %+v", e)
+	}
+}
+
+// failingInvoice fails every Create
+type failingInvoice struct {
+	invoice.Storage
+}
+
+func (failingInvoice) Create(context.Context, *invoice.Model) error {
+	return invoice.ErrWithoutHeader
+}
+
+// TestLoggedInvoiceWithoutHeader checks that a failed create of an invoice
+// without header is reported without id
+func TestLoggedInvoiceWithoutHeader(t *testing.T) {
+	log := &testLogger{}
+	l := &loggedInvoice{failingInvoice{}, events{log, newMetrics(Memory, nil), nil, Memory, "invoice_headers"}}
+
+	if err := l.Create(context.Background(), &invoice.Model{}); !errors.Is(err, invoice.ErrWithoutHeader) {
+		t.Fatalf("Create: err = %v, want %v", err, invoice.ErrWithoutHeader)
+	}
+	e := log.last(t)
+	if _, ok := e.attrs["id"]; e.level != "error" || e.attrs["operation"] != "create" || ok {
+		t.Errorf("create event = %+v, want an error without id", e)
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"github.com/eltaljohn/go-db/pkg/trace"
+	"time"
+)
+
+// Logger receives the events of the storages as a message and key value
+// pairs, *slog.Logger implements it
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// nopLogger is the Logger of the stores opened without WithLogger
+type nopLogger struct{}
+
+func (nopLogger) DebugContext(context.Context, string, ...interface{}) {}
+func (nopLogger) InfoContext(context.Context, string, ...interface{})  {}
+func (nopLogger) ErrorContext(context.Context, string, ...interface{}) {}
+
+// Option configures the Store
+type Option func(*Store)
+
+// WithTracer makes the storages of the store start a span per operation
+func WithTracer(t *trace.Tracer) Option {
+	return func(s *Store) {
+		s.tracer = t
+	}
+}
+
+// WithLogger makes the store report its events to l
+func WithLogger(l Logger) Option {
+	return func(s *Store) {
+		if l != nil {
+			s.log = l
+		}
+	}
+}
+
+// events reports the operations of a storage on table to the logger, the
+// metrics and the tracer of the store
+type events struct {
+	log     Logger
+	metrics *Metrics
+	tracer  *trace.Tracer
+	driver  Driver
+	table   string
+}
+
+// call is an operation of a storage in course
+type call struct {
+	events
+	ctx   context.Context
+	op    string
+	start time.Time
+	span  *trace.Span
+}
+
+// begin starts the operation op, the returned context carries its span
+func (e events) begin(ctx context.Context, op string) (context.Context, *call) {
+	ctx, span := e.tracer.Start(ctx, e.table+"."+op)
+	span.SetAttributes(
+		"db.system", e.driver.system(),
+		"db.sql.table", e.table,
+		"db.operation", op,
+		"db.statement.name", e.table+"."+op,
+	)
+	return ctx, &call{e, ctx, op, time.Now(), span}
+}
+
+// end reports the operation on the row id. The writes are reported as
+// info, the reads as debug and the failures as errors. A zero id is left
+// out, args are added to the event and the span
+func (c *call) end(write bool, id uint, err error, args ...interface{}) {
+	d := time.Since(c.start)
+	c.metrics.observe(c.table, c.op, d, err)
+
+	if id != 0 {
+		c.span.SetAttributes("db.row_id", id)
+	}
+	c.span.SetAttributes(args...)
+	c.span.End(err)
+
+	attrs := []interface{}{
+		"operation", c.op,
+		"table", c.table,
+		"driver", string(c.driver),
+	}
+	if id != 0 {
+		attrs = append(attrs, "id", id)
+	}
+	attrs = append(attrs, args...)
+	attrs = append(attrs, "duration", d)
+
+	switch {
+	case err != nil:
+		c.log.ErrorContext(c.ctx, "storage", append(attrs, "error", err.Error())...)
+	case write:
+		c.log.InfoContext(c.ctx, "storage", attrs...)
+	default:
+		c.log.DebugContext(c.ctx, "storage", attrs...)
+	}
+}
+
+// system returns the db.system of the spans of the driver
+func (d Driver) system() string {
+	switch d {
+	case Postgres:
+		return "postgresql"
+	case MySQL:
+		return "mysql"
+	case SQLite:
+		return "sqlite"
+	default:
+		return "memory"
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"sync"
+)
+
+// MemoryDB holds the tables used by the memory storages
+type MemoryDB struct {
+	mu       sync.RWMutex
+	products map[uint]product.Model
+	headers  map[uint]invoiceheader.Model
+	items    map[uint]invoiceitem.Model
+	// statusChanges of the invoices
+	statusChanges map[uint]invoiceheader.StatusChange
+
+	lastProductID uint
+	lastHeaderID  uint
+	lastItemID    uint
+	// lastStatusChangeID of statusChanges
+	lastStatusChangeID uint
+
+	// txMu is held by the transaction in course and by the writes made
+	// outside of a transaction, so a rollback only undoes its own writes
+	txMu sync.Mutex
+}
+
+// NewMemoryDB returns a new empty pointer of MemoryDB
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		products: make(map[uint]product.Model),
+		headers:  make(map[uint]invoiceheader.Model),
+		items:    make(map[uint]invoiceitem.Model),
+
+		statusChanges: make(map[uint]invoiceheader.StatusChange),
+	}
+}
+
+// lock locks db for a write made outside of a transaction, it waits for
+// the transaction in course to finish
+func (db *MemoryDB) lock() {
+	db.txMu.Lock()
+	db.mu.Lock()
+}
+
+func (db *MemoryDB) unlock() {
+	db.mu.Unlock()
+	db.txMu.Unlock()
+}
+
+// memoryTx keeps the operations needed to undo a transaction
+type memoryTx struct {
+	db   *MemoryDB
+	undo []func()
+}
+
+// begin starts a transaction, only one transaction runs at a time
+func (db *MemoryDB) begin() *memoryTx {
+	db.txMu.Lock()
+	return &memoryTx{db: db}
+}
+
+// record registers an undo operation of a write of the transaction, a nil
+// tx is a write made outside of a transaction. It must be called with
+// db.mu locked
+func (tx *memoryTx) record(undo func()) {
+	if tx != nil {
+		tx.undo = append(tx.undo, undo)
+	}
+}
+
+// Commit keeps the changes made by the transaction
+func (tx *memoryTx) Commit() error {
+	tx.db.txMu.Unlock()
+	return nil
+}
+
+// Rollback undoes the changes made by the transaction
+func (tx *memoryTx) Rollback() error {
+	tx.db.mu.Lock()
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.db.mu.Unlock()
+
+	tx.db.txMu.Unlock()
+	return nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+)
+
+// MemoryInvoice is used to work in memory - invoice
+type MemoryInvoice struct {
+	db            *MemoryDB
+	storageHeader *MemoryInvoiceHeader
+	storageItems  *MemoryInvoiceItem
+}
+
+// NewMemoryInvoice returns a new pointer of MemoryInvoice, header and
+// items are saved in db
+func NewMemoryInvoice(db *MemoryDB) *MemoryInvoice {
+	return &MemoryInvoice{db, NewMemoryInvoiceHeader(db), NewMemoryInvoiceItem(db)}
+}
+
+// Create implements interface invoice.Storage
+func (p *MemoryInvoice) Create(ctx context.Context, m *invoice.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := p.db.begin()
+
+	err := traced(ctx, "invoice_headers.insert", func(ctx context.Context) error {
+		return p.storageHeader.create(tx, m.Header)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = traced(ctx, "invoice_items.insert", func(ctx context.Context) error {
+		return p.storageItems.create(tx, m.Header.ID, m.Items)
+	}, "rows", len(m.Items))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return traced(ctx, "commit", func(context.Context) error {
+		return tx.Commit()
+	})
+}
+
+// GetByID implements interface invoice.Storage
+func (p *MemoryInvoice) GetByID(ctx context.Context, id uint) (*invoice.Model, error) {
+	return getInvoice(ctx, p.storageHeader, p.storageItems, id)
+}
+
+// List implements interface invoice.Storage
+func (p *MemoryInvoice) List(ctx context.Context, f invoiceheader.Filter) (invoice.Models, error) {
+	return listInvoices(ctx, p.storageHeader, p.storageItems, f)
+}
+
+// ChangeStatus implements interface invoice.Storage
+func (p *MemoryInvoice) ChangeStatus(ctx context.Context, c *invoiceheader.StatusChange) error {
+	return p.Cancel(ctx, c, nil)
+}
+
+// Cancel implements interface invoice.Storage
+func (p *MemoryInvoice) Cancel(ctx context.Context, c *invoiceheader.StatusChange, creditNote *invoice.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := p.db.begin()
+
+	err := traced(ctx, "invoice_headers.update_status", func(ctx context.Context) error {
+		return p.storageHeader.changeStatus(tx, c)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if creditNote != nil {
+		err = traced(ctx, "invoice_headers.insert", func(ctx context.Context) error {
+			return p.storageHeader.create(tx, creditNote.Header)
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = traced(ctx, "invoice_items.insert", func(ctx context.Context) error {
+			return p.storageItems.create(tx, creditNote.Header.ID, creditNote.Items)
+		}, "rows", len(creditNote.Items))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return traced(ctx, "commit", func(context.Context) error {
+		return tx.Commit()
+	})
+}
+
+// StatusHistory implements interface invoice.Storage
+func (p *MemoryInvoice) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	return p.storageHeader.StatusHistory(ctx, id)
+}
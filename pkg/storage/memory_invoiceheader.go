@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemoryInvoiceHeader used to work in memory - invoice_headers
+type MemoryInvoiceHeader struct {
+	db *MemoryDB
+}
+
+// NewMemoryInvoiceHeader returns a new pointer of MemoryInvoiceHeader
+func NewMemoryInvoiceHeader(db *MemoryDB) *MemoryInvoiceHeader {
+	return &MemoryInvoiceHeader{db}
+}
+
+// Migrate implements interface invoiceHeader.storage
+func (p *MemoryInvoiceHeader) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// CreateTx implements interface invoiceHeader.storage. The header is
+// saved outside of a transaction, MemoryInvoice creates it inside its own
+func (p *MemoryInvoiceHeader) CreateTx(ctx context.Context, _ *sql.Tx, m *invoiceheader.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.txMu.Lock()
+	defer p.db.txMu.Unlock()
+
+	return p.create(nil, m)
+}
+
+// create saves m, it is undone if tx is rolled back
+func (p *MemoryInvoiceHeader) create(tx *memoryTx, m *invoiceheader.Model) error {
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	p.db.lastHeaderID++
+	m.ID = p.db.lastHeaderID
+	m.CreateAt = time.Now()
+	p.db.headers[m.ID] = *m
+
+	id := m.ID
+	tx.record(func() { delete(p.db.headers, id) })
+
+	return nil
+}
+
+// GetByID implements interface invoiceHeader.storage
+func (p *MemoryInvoiceHeader) GetByID(ctx context.Context, id uint) (*invoiceheader.Model, error) {
+	if err := ctx.Err(); err != nil {
+		return &invoiceheader.Model{}, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	m, ok := p.db.headers[id]
+	if !ok {
+		return &invoiceheader.Model{}, sql.ErrNoRows
+	}
+
+	return &m, nil
+}
+
+// List implements interface invoiceHeader.storage
+func (p *MemoryInvoiceHeader) List(ctx context.Context, f invoiceheader.Filter) (invoiceheader.Models, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	client := strings.ToLower(f.Client)
+	ms := make(invoiceheader.Models, 0)
+	for _, m := range p.db.headers {
+		m := m
+		switch {
+		case client != "" && !strings.Contains(strings.ToLower(m.Client), client),
+			!f.From.IsZero() && m.CreateAt.Before(f.From),
+			!f.To.IsZero() && !m.CreateAt.Before(f.To),
+			f.Status != "" && m.Status != f.Status:
+			continue
+		}
+		ms = append(ms, &m)
+	}
+
+	sort.Slice(ms, func(i, j int) bool {
+		if !ms[i].CreateAt.Equal(ms[j].CreateAt) {
+			return ms[i].CreateAt.After(ms[j].CreateAt)
+		}
+		return ms[i].ID > ms[j].ID
+	})
+
+	if f.Offset >= len(ms) {
+		return invoiceheader.Models{}, nil
+	}
+	ms = ms[f.Offset:]
+	if l := limit(f.Limit, invoiceheader.DefaultLimit, invoiceheader.MaxLimit); l < len(ms) {
+		ms = ms[:l]
+	}
+
+	return ms, nil
+}
+
+// ChangeStatusTx implements interface invoiceHeader.storage. The change is
+// saved outside of a transaction, MemoryInvoice makes it inside its own
+func (p *MemoryInvoiceHeader) ChangeStatusTx(ctx context.Context, _ *sql.Tx, c *invoiceheader.StatusChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.txMu.Lock()
+	defer p.db.txMu.Unlock()
+
+	return p.changeStatus(nil, c)
+}
+
+// changeStatus saves c and the new status of its header, they are undone
+// if tx is rolled back
+func (p *MemoryInvoiceHeader) changeStatus(tx *memoryTx, c *invoiceheader.StatusChange) error {
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	m, ok := p.db.headers[c.InvoiceHeaderID]
+	if !ok || m.Status != c.From {
+		return invoiceheader.ErrStatusChanged
+	}
+
+	old := m
+	m.Status = c.To
+	m.UpdatedAt = c.CreatedAt
+	p.db.headers[m.ID] = m
+
+	p.db.lastStatusChangeID++
+	c.ID = p.db.lastStatusChangeID
+	p.db.statusChanges[c.ID] = *c
+
+	id := c.ID
+	tx.record(func() {
+		p.db.headers[old.ID] = old
+		delete(p.db.statusChanges, id)
+	})
+
+	return nil
+}
+
+// StatusHistory implements interface invoiceHeader.storage
+func (p *MemoryInvoiceHeader) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	cs := make(invoiceheader.StatusChanges, 0)
+	for _, c := range p.db.statusChanges {
+		c := c
+		if c.InvoiceHeaderID == id {
+			cs = append(cs, &c)
+		}
+	}
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ID < cs[j].ID })
+
+	return cs, nil
+}
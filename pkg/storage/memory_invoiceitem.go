@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"sort"
+	"time"
+)
+
+// MemoryInvoiceItem used to work in memory - invoice_items
+type MemoryInvoiceItem struct {
+	db *MemoryDB
+}
+
+// NewMemoryInvoiceItem returns a new pointer of MemoryInvoiceItem
+func NewMemoryInvoiceItem(db *MemoryDB) *MemoryInvoiceItem {
+	return &MemoryInvoiceItem{db}
+}
+
+// Migrate implements interface invoiceItem.storage
+func (p *MemoryInvoiceItem) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// CreateTx implements interface invoiceItem.storage. The items are saved
+// outside of a transaction, MemoryInvoice creates them inside its own
+func (p *MemoryInvoiceItem) CreateTx(ctx context.Context, _ *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.txMu.Lock()
+	defer p.db.txMu.Unlock()
+
+	return p.create(nil, headerID, ms)
+}
+
+// create saves ms, they are undone if tx is rolled back. No item is saved
+// if one of them references a missing product
+func (p *MemoryInvoiceItem) create(tx *memoryTx, headerID uint, ms invoiceitem.Models) error {
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	if _, ok := p.db.headers[headerID]; !ok {
+		return fmt.Errorf("no existe la factura con id: %d", headerID)
+	}
+	for _, item := range ms {
+		if _, ok := p.db.products[item.ProductID]; !ok {
+			return &product.Error{
+				ID:   item.ProductID,
+				Kind: product.ErrForeignKey,
+				Err:  fmt.Errorf("no existe el producto con id: %d", item.ProductID),
+			}
+		}
+	}
+
+	for _, item := range ms {
+		p.db.lastItemID++
+		item.ID = p.db.lastItemID
+		item.InvoiceHeaderID = headerID
+		item.CreatedAt = time.Now()
+		p.db.items[item.ID] = *item
+
+		id := item.ID
+		tx.record(func() { delete(p.db.items, id) })
+	}
+
+	return nil
+}
+
+// GetByHeaderID implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *MemoryInvoiceItem) GetByHeaderID(ctx context.Context, headerID uint) (invoiceitem.Models, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	ms := make(invoiceitem.Models, 0)
+	for _, m := range p.db.items {
+		if m.InvoiceHeaderID != headerID {
+			continue
+		}
+		m := m
+		m.ProductName = p.db.products[m.ProductID].Name
+		ms = append(ms, &m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+
+	return ms, nil
+}
+
+// GetByHeaderIDs implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *MemoryInvoiceItem) GetByHeaderIDs(ctx context.Context, headerIDs []uint) (invoiceitem.Models, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint]bool, len(headerIDs))
+	for _, id := range headerIDs {
+		ids[id] = true
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	ms := make(invoiceitem.Models, 0)
+	for _, m := range p.db.items {
+		if !ids[m.InvoiceHeaderID] {
+			continue
+		}
+		m := m
+		m.ProductName = p.db.products[m.ProductID].Name
+		ms = append(ms, &m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].InvoiceHeaderID != ms[j].InvoiceHeaderID {
+			return ms[i].InvoiceHeaderID < ms[j].InvoiceHeaderID
+		}
+		return ms[i].ID < ms[j].ID
+	})
+
+	return ms, nil
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memoryProduct used to work in memory - product
+type memoryProduct struct {
+	db *MemoryDB
+}
+
+// NewMemoryProduct returns a new pointer of memoryProduct
+func NewMemoryProduct(db *MemoryDB) product.Storage {
+	return &memoryProduct{db}
+}
+
+// Migrate implements interface product.storage
+func (p *memoryProduct) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Create implements interface product.storage
+func (p *memoryProduct) Create(ctx context.Context, m *product.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.lock()
+	defer p.db.unlock()
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	p.db.lastProductID++
+	m.ID = p.db.lastProductID
+	m.Version = 1
+	p.db.products[m.ID] = *m
+
+	return nil
+}
+
+// GetAll implements interface product.storage
+func (p *memoryProduct) GetAll(ctx context.Context) (product.Models, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	withDeleted := product.IncludeDeleted(ctx)
+	ms := make(product.Models, 0, len(p.db.products))
+	for _, m := range p.db.products {
+		m := m
+		if m.Deleted() && !withDeleted {
+			continue
+		}
+		ms = append(ms, &m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+
+	return ms, nil
+}
+
+// List implements interface product.storage
+func (p *memoryProduct) List(ctx context.Context, o product.ListOptions) (product.Models, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	dir := 1
+	if o.Desc {
+		dir = -1
+	}
+
+	withDeleted := product.IncludeDeleted(ctx)
+	name := strings.ToLower(o.Name)
+	ms := make(product.Models, 0)
+	for _, m := range p.db.products {
+		m := m
+		switch {
+		case m.Deleted() && !withDeleted,
+			name != "" && !strings.Contains(strings.ToLower(m.Name), name),
+			o.MinPrice != nil && (m.Price.Currency != o.MinPrice.Currency || m.Price.Amount < o.MinPrice.Amount),
+			o.MaxPrice != nil && (m.Price.Currency != o.MaxPrice.Currency || m.Price.Amount > o.MaxPrice.Amount),
+			o.After != nil && compareProduct(o.Sort, &m, o.After)*dir <= 0:
+			continue
+		}
+		ms = append(ms, &m)
+	}
+
+	sort.Slice(ms, func(i, j int) bool {
+		return compareProduct(o.Sort, ms[i], product.CursorOf(ms[j]))*dir < 0
+	})
+
+	if o.Offset >= len(ms) {
+		return product.Models{}, nil
+	}
+	ms = ms[o.Offset:]
+	if l := limit(o.Limit, product.DefaultLimit, product.MaxLimit); l < len(ms) {
+		ms = ms[:l]
+	}
+
+	return ms, nil
+}
+
+// compareProduct returns -1, 0 or 1 when m goes before, in or after the
+// cursor c in the ascending order of s, the ID breaks the ties
+func compareProduct(s product.Sort, m *product.Model, c *product.Cursor) int {
+	r := 0
+	switch s {
+	case product.SortName:
+		r = strings.Compare(m.Name, c.Name)
+	case product.SortPrice:
+		r = compareInt64(m.Price.Amount, c.Price)
+	case product.SortCreatedAt:
+		r = compareInt64(m.CreatedAt.UnixNano(), c.CreatedAt.UnixNano())
+	}
+	if r == 0 {
+		r = compareInt64(int64(m.ID), int64(c.ID))
+	}
+	return r
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Each implements interface product.storage, fn is called without the
+// lock so it can use the storage
+func (p *memoryProduct) Each(ctx context.Context, fn func(*product.Model) error) error {
+	ms, err := p.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByID implements interface product.storage
+func (p *memoryProduct) GetByID(ctx context.Context, id uint) (*product.Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	defer p.db.mu.RUnlock()
+
+	m, ok := p.db.products[id]
+	if !ok || (m.Deleted() && !product.IncludeDeleted(ctx)) {
+		return nil, productNotFound(id)
+	}
+
+	return &m, nil
+}
+
+// Update implements interface product.storage
+func (p *memoryProduct) Update(ctx context.Context, m *product.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.lock()
+	defer p.db.unlock()
+
+	stored, ok := p.db.products[m.ID]
+	if !ok || stored.Deleted() {
+		return productNotFound(m.ID)
+	}
+	if m.Version != 0 && m.Version != stored.Version {
+		return &product.Error{ID: m.ID, Kind: product.ErrStaleVersion}
+	}
+
+	stored.Name = m.Name
+	stored.Observations = m.Observations
+	stored.Price = m.Price
+	stored.UpdatedAt = m.UpdatedAt
+	stored.Version++
+	p.db.products[m.ID] = stored
+	if m.Version != 0 {
+		m.Version = stored.Version
+	}
+
+	return nil
+}
+
+// Patch implements interface product.storage
+func (p *memoryProduct) Patch(ctx context.Context, id uint, patch product.Patch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if patch.Empty() {
+		return product.ErrEmptyPatch
+	}
+
+	p.db.lock()
+	defer p.db.unlock()
+
+	stored, ok := p.db.products[id]
+	if !ok || stored.Deleted() {
+		return productNotFound(id)
+	}
+	if patch.Version != 0 && patch.Version != stored.Version {
+		return &product.Error{ID: id, Kind: product.ErrStaleVersion}
+	}
+
+	patch.Apply(&stored)
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	p.db.products[id] = stored
+
+	return nil
+}
+
+// Delete implements interface product.storage, it sets DeletedAt
+func (p *memoryProduct) Delete(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.lock()
+	defer p.db.unlock()
+
+	stored, ok := p.db.products[id]
+	if !ok || stored.Deleted() {
+		return productNotFound(id)
+	}
+
+	stored.DeletedAt = time.Now()
+	stored.Version++
+	p.db.products[id] = stored
+	return nil
+}
+
+// Restore implements interface product.storage
+func (p *memoryProduct) Restore(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.db.lock()
+	defer p.db.unlock()
+
+	stored, ok := p.db.products[id]
+	if !ok || !stored.Deleted() {
+		return productNotFound(id)
+	}
+
+	stored.DeletedAt = time.Time{}
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	p.db.products[id] = stored
+	return nil
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"testing"
+	"time"
+)
+
+// memoryDB returns a MemoryDB with the product 1
+func memoryDB(t *testing.T) *MemoryDB {
+	t.Helper()
+
+	db := NewMemoryDB()
+	if err := NewMemoryProduct(db).Create(context.Background(), &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return db
+}
+
+func TestMemoryProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(*MemoryDB, product.Storage) error
+		wantErr bool
+		// wantName is the name of the product 1 after run, empty if it
+		// was deleted
+		wantName string
+	}{
+		{
+			name: "update",
+			run: func(_ *MemoryDB, ps product.Storage) error {
+				return ps.Update(context.Background(), &product.Model{ID: 1, Name: "borrador"})
+			},
+			wantName: "borrador",
+		},
+		{
+			name: "update missing",
+			run: func(_ *MemoryDB, ps product.Storage) error {
+				return ps.Update(context.Background(), &product.Model{ID: 9, Name: "borrador"})
+			},
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+		{
+			name: "delete",
+			run:  func(_ *MemoryDB, ps product.Storage) error { return ps.Delete(context.Background(), 1) },
+		},
+		{
+			name:     "delete missing",
+			run:      func(_ *MemoryDB, ps product.Storage) error { return ps.Delete(context.Background(), 9) },
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+		{
+			name: "delete referenced by an invoice",
+			run: func(db *MemoryDB, ps product.Storage) error {
+				m := &invoice.Model{
+					Header: &invoiceheader.Model{Client: "Alexys"},
+					Items:  invoiceitem.Models{{ProductID: 1}},
+				}
+				if err := NewMemoryInvoice(db).Create(context.Background(), m); err != nil {
+					return err
+				}
+				return ps.Delete(context.Background(), 1)
+			},
+		},
+		{
+			name: "delete twice",
+			run: func(_ *MemoryDB, ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Delete(context.Background(), 1)
+			},
+			wantErr: true,
+		},
+		{
+			name: "update deleted",
+			run: func(_ *MemoryDB, ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Update(context.Background(), &product.Model{ID: 1, Name: "borrador"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "restore",
+			run: func(_ *MemoryDB, ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Restore(context.Background(), 1)
+			},
+			wantName: "lápiz",
+		},
+		{
+			name:     "restore active",
+			run:      func(_ *MemoryDB, ps product.Storage) error { return ps.Restore(context.Background(), 1) },
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memoryDB(t)
+			ps := NewMemoryProduct(db)
+
+			if err := tt.run(db, ps); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			m, err := ps.GetByID(context.Background(), 1)
+			if tt.wantName == "" {
+				if !errors.Is(err, product.ErrNotFound) {
+					t.Errorf("GetByID: err = %v, want %v", err, product.ErrNotFound)
+				}
+				if m, err := ps.GetByID(product.WithDeleted(context.Background()), 1); err != nil || !m.Deleted() {
+					t.Errorf("GetByID with deleted = %v, %v, want the deleted product", m, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if m.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", m.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestMemoryInvoiceCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     invoiceitem.Models
+		wantErr   bool
+		wantItems int
+	}{
+		{
+			name:      "ok",
+			items:     invoiceitem.Models{{ProductID: 1}, {ProductID: 1}},
+			wantItems: 2,
+		},
+		{
+			name: "without items",
+		},
+		{
+			name:    "missing product rolls back",
+			items:   invoiceitem.Models{{ProductID: 1}, {ProductID: 9}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memoryDB(t)
+			m := &invoice.Model{Header: &invoiceheader.Model{Client: "Alexys"}, Items: tt.items}
+
+			if err := NewMemoryInvoice(db).Create(context.Background(), m); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			wantHeaders := 1
+			if tt.wantErr {
+				wantHeaders = 0
+			}
+			if len(db.headers) != wantHeaders || len(db.items) != tt.wantItems {
+				t.Fatalf("db has %d headers and %d items, want %d and %d", len(db.headers), len(db.items), wantHeaders, tt.wantItems)
+			}
+			for _, item := range db.items {
+				if item.InvoiceHeaderID != m.Header.ID {
+					t.Errorf("item %d belongs to the invoice %d, want %d", item.ID, item.InvoiceHeaderID, m.Header.ID)
+				}
+			}
+		})
+	}
+}
+
+// TestMemoryRollbackKeepsOtherWrites checks that a rollback does not undo
+// a write made meanwhile outside of the transaction
+func TestMemoryRollbackKeepsOtherWrites(t *testing.T) {
+	db := memoryDB(t)
+	headers := NewMemoryInvoiceHeader(db)
+
+	tx := db.begin()
+	if err := headers.create(tx, &invoiceheader.Model{Client: "rollback"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	done := make(chan error)
+	other := &invoiceheader.Model{Client: "other"}
+	go func() {
+		done <- headers.CreateTx(context.Background(), nil, other)
+	}()
+
+	// give the other write time to run if it did not wait for tx
+	time.Sleep(20 * time.Millisecond)
+	tx.Rollback()
+
+	if err := <-done; err != nil {
+		t.Fatalf("CreateTx: %v", err)
+	}
+	if len(db.headers) != 1 {
+		t.Fatalf("db has %d headers, want 1", len(db.headers))
+	}
+	if h, ok := db.headers[other.ID]; !ok || h.Client != "other" {
+		t.Errorf("the write made outside of the transaction was undone")
+	}
+}
+
+func TestMemoryInvoiceGetAndList(t *testing.T) {
+	ctx := context.Background()
+	db := memoryDB(t)
+	storage := NewMemoryInvoice(db)
+
+	for _, client := range []string{"Alexys", "Edteam", "alexys ltda"} {
+		m := &invoice.Model{Header: &invoiceheader.Model{Client: client}, Items: invoiceitem.Models{{ProductID: 1}}}
+		if err := storage.Create(ctx, m); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	m, err := storage.GetByID(ctx, 2)
+	if err != nil || m.Header.Client != "Edteam" || len(m.Items) != 1 || m.Items[0].ProductName != "lápiz" {
+		t.Errorf("GetByID = %+v, %v, want the invoice of Edteam with its item", m, err)
+	}
+	if _, err := storage.GetByID(ctx, 9); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetByID of a missing invoice: err = %v, want sql.ErrNoRows", err)
+	}
+
+	ms, err := storage.List(ctx, invoiceheader.Filter{Client: "ALEXYS"})
+	if err != nil || len(ms) != 2 || ms[0].Header.ID != 3 || ms[1].Header.ID != 1 {
+		t.Fatalf("List = %v, %v, want the invoices 3 and 1", ms, err)
+	}
+	for _, m := range ms {
+		if len(m.Items) != 1 || m.Items[0].InvoiceHeaderID != m.Header.ID {
+			t.Errorf("invoice %d has the items %+v", m.Header.ID, m.Items)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms
+var LatencyBuckets = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Metrics counts the operations of the storages of a Store and measures
+// their latency, it is safe for concurrent use
+type Metrics struct {
+	driver Driver
+	db     *sql.DB
+
+	mu  sync.Mutex
+	ops map[operationKey]*operationMetrics
+}
+
+type operationKey struct {
+	table     string
+	operation string
+}
+
+type operationMetrics struct {
+	calls  uint64
+	errors map[string]uint64
+	// buckets has a count per LatencyBuckets plus the +Inf one, they are
+	// not cumulative
+	buckets []uint64
+	sum     time.Duration
+}
+
+// newMetrics returns the metrics of a store of driver, db is nil for Memory
+func newMetrics(driver Driver, db *sql.DB) *Metrics {
+	return &Metrics{driver: driver, db: db, ops: make(map[operationKey]*operationMetrics)}
+}
+
+// observe records a call of operation on table that took d
+func (m *Metrics) observe(table, operation string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := operationKey{table, operation}
+	op, ok := m.ops[key]
+	if !ok {
+		op = &operationMetrics{
+			errors:  make(map[string]uint64),
+			buckets: make([]uint64, len(LatencyBuckets)+1),
+		}
+		m.ops[key] = op
+	}
+
+	op.calls++
+	op.sum += d
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+	op.buckets[i]++
+	if err != nil {
+		op.errors[metricErrorKind(err)]++
+	}
+}
+
+// metricErrorKind returns the label of the kind of err
+func metricErrorKind(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, product.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return "not_found"
+	case errors.Is(err, product.ErrStaleVersion):
+		return "stale_version"
+	case errors.Is(err, invoiceheader.ErrStatusChanged):
+		return "status_changed"
+	case errors.Is(err, product.ErrConflict):
+		return "conflict"
+	case errors.Is(err, product.ErrForeignKey):
+		return "foreign_key"
+	case errors.Is(err, product.ErrValidation), errors.Is(err, product.ErrEmptyPatch):
+		return "validation"
+	}
+
+	switch errorKind(err) {
+	case product.ErrConflict:
+		return "conflict"
+	case product.ErrForeignKey:
+		return "foreign_key"
+	case product.ErrValidation:
+		return "validation"
+	default:
+		return "other"
+	}
+}
+
+// MetricsSnapshot is a copy of the metrics at a point in time
+type MetricsSnapshot struct {
+	Driver     Driver
+	Operations []OperationMetrics
+	// DB are the stats of the connection pool, zero for Memory
+	DB sql.DBStats
+}
+
+// OperationMetrics of an operation of the storage of a table
+type OperationMetrics struct {
+	Table     string
+	Operation string
+	Calls     uint64
+	// Errors by kind: not_found, stale_version, status_changed, conflict,
+	// foreign_key, validation, canceled, timeout or other
+	Errors map[string]uint64
+	// Buckets are the cumulative counts of the calls that took at most
+	// the LatencyBuckets of the same index, Calls includes the slower ones
+	Buckets []uint64
+	Sum     time.Duration
+}
+
+// Operation returns the metrics of operation on table, the zero value if
+// it was not called
+func (s MetricsSnapshot) Operation(table, operation string) OperationMetrics {
+	for _, op := range s.Operations {
+		if op.Table == table && op.Operation == operation {
+			return op
+		}
+	}
+	return OperationMetrics{Table: table, Operation: operation}
+}
+
+// Snapshot returns a copy of the metrics, the operations are sorted by
+// table and operation
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{Driver: m.driver}
+	if m.db != nil {
+		s.DB = m.db.Stats()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, op := range m.ops {
+		o := OperationMetrics{
+			Table:     key.table,
+			Operation: key.operation,
+			Calls:     op.calls,
+			Errors:    make(map[string]uint64, len(op.errors)),
+			Buckets:   make([]uint64, len(LatencyBuckets)),
+			Sum:       op.sum,
+		}
+		for kind, n := range op.errors {
+			o.Errors[kind] = n
+		}
+		var total uint64
+		for i := range LatencyBuckets {
+			total += op.buckets[i]
+			o.Buckets[i] = total
+		}
+		s.Operations = append(s.Operations, o)
+	}
+
+	sort.Slice(s.Operations, func(i, j int) bool {
+		a, b := s.Operations[i], s.Operations[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Operation < b.Operation
+	})
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.Snapshot().WritePrometheus(w)
+}
+
+// WritePrometheus writes s in the Prometheus text format
+func (s MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	p := &promWriter{w: w}
+	driver := string(s.Driver)
+
+	p.header("godb_storage_calls_total", "counter", "Calls of the storage operations.")
+	for _, op := range s.Operations {
+		p.sample("godb_storage_calls_total", op.labels(driver), float64(op.Calls))
+	}
+
+	p.header("godb_storage_errors_total", "counter", "Failed calls of the storage operations by kind.")
+	for _, op := range s.Operations {
+		kinds := make([]string, 0, len(op.Errors))
+		for kind := range op.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			p.sample("godb_storage_errors_total", append(op.labels(driver), "kind", kind), float64(op.Errors[kind]))
+		}
+	}
+
+	p.header("godb_storage_duration_seconds", "histogram", "Latency of the storage operations.")
+	for _, op := range s.Operations {
+		for i, le := range LatencyBuckets {
+			p.sample("godb_storage_duration_seconds_bucket", append(op.labels(driver), "le", formatFloat(le.Seconds())), float64(op.Buckets[i]))
+		}
+		p.sample("godb_storage_duration_seconds_bucket", append(op.labels(driver), "le", "+Inf"), float64(op.Calls))
+		p.sample("godb_storage_duration_seconds_sum", op.labels(driver), op.Sum.Seconds())
+		p.sample("godb_storage_duration_seconds_count", op.labels(driver), float64(op.Calls))
+	}
+
+	if s.Driver != Memory {
+		labels := []string{"driver", driver}
+		gauges := []struct {
+			name, kind, help string
+			value            float64
+		}{
+			{"godb_db_max_open_connections", "gauge", "Max open connections of the pool.", float64(s.DB.MaxOpenConnections)},
+			{"godb_db_open_connections", "gauge", "Open connections, in use and idle.", float64(s.DB.OpenConnections)},
+			{"godb_db_in_use_connections", "gauge", "Connections in use.", float64(s.DB.InUse)},
+			{"godb_db_idle_connections", "gauge", "Idle connections.", float64(s.DB.Idle)},
+			{"godb_db_wait_count_total", "counter", "Connections waited for.", float64(s.DB.WaitCount)},
+			{"godb_db_wait_duration_seconds_total", "counter", "Time blocked waiting for a connection.", s.DB.WaitDuration.Seconds()},
+		}
+		for _, g := range gauges {
+			p.header(g.name, g.kind, g.help)
+			p.sample(g.name, labels, g.value)
+		}
+	}
+
+	return p.err
+}
+
+func (o OperationMetrics) labels(driver string) []string {
+	return []string{"driver", driver, "table", o.Table, "operation", o.Operation}
+}
+
+// promWriter writes the lines of the Prometheus text format, it keeps the
+// first error
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) header(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample of name, labels are pairs of name and value
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	p.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+func (p *promWriter) printf(format string, a ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, a...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
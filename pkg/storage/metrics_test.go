@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{productNotFound(1), "not_found"},
+		{&product.Error{ID: 1, Kind: product.ErrStaleVersion}, "stale_version"},
+		{fmt.Errorf("list: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{product.ErrEmptyPatch, "validation"},
+		{errors.New("connection refused"), "other"},
+	}
+	for _, tt := range tests {
+		if got := metricErrorKind(tt.err); got != tt.want {
+			t.Errorf("metricErrorKind(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestWritePrometheus checks the whole text of the metrics of a memory
+// store, the buckets are cumulative and the errors are by kind
+func TestWritePrometheus(t *testing.T) {
+	m := newMetrics(Memory, nil)
+	m.observe("products", "get", 400*time.Microsecond, nil)
+	m.observe("products", "get", 3*time.Second, productNotFound(9))
+	m.observe("invoice_headers", "list", 20*time.Millisecond, nil)
+
+	var b bytes.Buffer
+	if err := m.Snapshot().WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+
+	buckets := func(labels string, counts ...int) string {
+		var s strings.Builder
+		for i, le := range LatencyBuckets {
+			fmt.Fprintf(&s, "godb_storage_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(le.Seconds()), counts[i])
+		}
+		return s.String()
+	}
+	invoices := `driver="MEMORY",table="invoice_headers",operation="list"`
+	products := `driver="MEMORY",table="products",operation="get"`
+	want := "# HELP godb_storage_calls_total Calls of the storage operations.\n" +
+		"# TYPE godb_storage_calls_total counter\n" +
+		"godb_storage_calls_total{" + invoices + "} 1\n" +
+		"godb_storage_calls_total{" + products + "} 2\n" +
+		"# HELP godb_storage_errors_total Failed calls of the storage operations by kind.\n" +
+		"# TYPE godb_storage_errors_total counter\n" +
+		"godb_storage_errors_total{" + products + ",kind=\"not_found\"} 1\n" +
+		"# HELP godb_storage_duration_seconds Latency of the storage operations.\n" +
+		"# TYPE godb_storage_duration_seconds histogram\n" +
+		buckets(invoices, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1) +
+		"godb_storage_duration_seconds_bucket{" + invoices + ",le=\"+Inf\"} 1\n" +
+		"godb_storage_duration_seconds_sum{" + invoices + "} 0.02\n" +
+		"godb_storage_duration_seconds_count{" + invoices + "} 1\n" +
+		buckets(products, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2) +
+		"godb_storage_duration_seconds_bucket{" + products + ",le=\"+Inf\"} 2\n" +
+		"godb_storage_duration_seconds_sum{" + products + "} 3.0004\n" +
+		"godb_storage_duration_seconds_count{" + products + "} 2\n"
+	if got := b.String(); got != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestMetricsHandler checks that the metrics of a SQLite store count the
+// calls of its storages and have the stats of the pool
+func TestMetricsHandler(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "metrics.sqlite")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if err := s.Product().Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if _, err := s.Product().GetByID(ctx, 9); !errors.Is(err, product.ErrNotFound) {
+		t.Fatalf("GetByID: err = %v, want %v", err, product.ErrNotFound)
+	}
+
+	if op := s.Metrics().Snapshot().Operation("products", "get"); op.Calls != 1 || op.Errors["not_found"] != 1 {
+		t.Errorf("get = %+v, want a call that was not found", op)
+	}
+
+	rec := httptest.NewRecorder()
+	s.Metrics().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`godb_storage_calls_total{driver="SQLITE",table="products",operation="get"} 1`,
+		`godb_storage_errors_total{driver="SQLITE",table="products",operation="get",kind="not_found"} 1`,
+		"# TYPE godb_db_open_connections gauge",
+		`godb_db_max_open_connections{driver="SQLITE"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics without %s:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+}
@@ -1,57 +1,143 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoiceheader"
 )
 
-// psqlMigrateInvoiceHeader cons to create invoice_headers table
 const (
-	mySQLMigrateInvoiceHeader = `CREATE TABLE IF NOT EXISTS invoice_headers(
-	id INT AUTO_INCREMENT NOT NULL PRIMARY KEY,
-	client VARCHAR(25) NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP
-)`
-	mySQLCreateInvoiceHeader = `INSERT INTO invoice_headers(client) VALUES (?)`
+	mySQLCreateInvoiceHeader = `INSERT INTO invoice_headers(client, status, kind, reference_id, currency, subtotal, tax, total)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	mySQLGetInvoiceHeaderByID      = getAllInvoiceHeaders + " WHERE id = ?"
+	mySQLUpdateInvoiceHeaderStatus = `UPDATE invoice_headers SET status = ?, updated_at = ?
+	WHERE id = ? AND status = ?`
+	mySQLCreateInvoiceStatusChange = `INSERT INTO invoice_status_changes(invoice_header_id, from_status, to_status, reason, created_at)
+	VALUES (?, ?, ?, ?, ?)`
+	mySQLGetInvoiceStatusChanges = getAllInvoiceStatusChanges + " WHERE invoice_header_id = ? ORDER BY id"
 )
 
 // MYSQLInvoiceHeader used to work with MySQL - invoice_headers
 type MYSQLInvoiceHeader struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
-// NewMYSQLInvoiceHeader returns a new pointer of MYSQLInvoiceHeader
+// NewMYSQLInvoiceHeader returns a new pointer of MYSQLInvoiceHeader, it
+// prepares a statement per call. The storages of a Store reuse them
 func NewMYSQLInvoiceHeader(db *sql.DB) *MYSQLInvoiceHeader {
-	return &MYSQLInvoiceHeader{db}
+	return &MYSQLInvoiceHeader{db, uncachedStmts(db)}
 }
 
-// Migrate implements interface invoiceHeader.storage
-func (p *MYSQLInvoiceHeader) Migrate() error {
-	stmt, err := p.db.Prepare(mySQLMigrateInvoiceHeader)
+// Migrate implements interface invoiceHeader.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *MYSQLInvoiceHeader) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, MySQL, "invoice_headers")
+}
+
+func (p *MYSQLInvoiceHeader) CreateTx(ctx context.Context, tx *sql.Tx, m *invoiceheader.Model) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, mySQLCreateInvoiceHeader)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec()
+	result, err := stmt.ExecContext(
+		ctx,
+		m.Client,
+		m.Status,
+		m.Kind,
+		uintToNull(m.ReferenceID),
+		m.Currency,
+		m.Subtotal.Amount,
+		m.Tax.Amount,
+		m.Total.Amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
 	if err != nil {
-		return nil
+		return err
 	}
 
-	fmt.Println("Migración de InvoiceHeader ejecutada correctamente")
+	m.ID = uint(id)
 	return nil
 }
 
-func (p *MYSQLInvoiceHeader) CreateTx(tx *sql.Tx, m *invoiceheader.Model) error {
-	stmt, err := tx.Prepare(mySQLCreateInvoiceHeader)
+// GetByID implements interface invoiceHeader.storage
+func (p *MYSQLInvoiceHeader) GetByID(ctx context.Context, id uint) (*invoiceheader.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, mySQLGetInvoiceHeaderByID)
+	if err != nil {
+		return &invoiceheader.Model{}, err
+	}
+	defer p.stmts.release(stmt)
+
+	return scanRowInvoiceHeader(stmt.QueryRowContext(ctx, id))
+}
+
+// List implements interface invoiceHeader.storage
+func (p *MYSQLInvoiceHeader) List(ctx context.Context, f invoiceheader.Filter) (invoiceheader.Models, error) {
+	query, args := listInvoiceHeaders(questionPlaceholder, plainTimestampCmp, f)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(invoiceheader.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceHeader(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// ChangeStatusTx implements interface invoiceHeader.storage, the update
+// only matches while the invoice keeps the status c.From
+func (p *MYSQLInvoiceHeader) ChangeStatusTx(ctx context.Context, tx *sql.Tx, c *invoiceheader.StatusChange) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, mySQLUpdateInvoiceHeaderStatus)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, c.To, c.CreatedAt, c.InvoiceHeaderID, c.From)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return invoiceheader.ErrStatusChanged
+	}
+
+	stmt, err = p.stmts.prepareTx(ctx, tx, mySQLCreateInvoiceStatusChange)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(m.Client)
+	result, err = stmt.ExecContext(
+		ctx,
+		c.InvoiceHeaderID,
+		c.From,
+		c.To,
+		stringToNull(c.Reason),
+		c.CreatedAt,
+	)
 	if err != nil {
 		return err
 	}
@@ -60,7 +146,31 @@ func (p *MYSQLInvoiceHeader) CreateTx(tx *sql.Tx, m *invoiceheader.Model) error
 	if err != nil {
 		return err
 	}
-	
-	m.ID = uint(id)
+
+	c.ID = uint(id)
 	return nil
 }
+
+// StatusHistory implements interface invoiceHeader.storage
+func (p *MYSQLInvoiceHeader) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	rows, err := p.db.QueryContext(ctx, mySQLGetInvoiceStatusChanges, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cs := make(invoiceheader.StatusChanges, 0)
+	for rows.Next() {
+		c, err := scanRowStatusChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
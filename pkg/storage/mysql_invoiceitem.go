@@ -1,73 +1,184 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoiceitem"
 )
 
 const (
-	mySQLMigrateInvoiceItem = `CREATE TABLE IF NOT EXISTS invoice_items(
-	id INT AUTO_INCREMENT NOT NULL PRIMARY KEY,
-	invoice_header_id INT NOT NULL,
-	product_id INT NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP,
-    CONSTRAINT invoice_items_invoice_header_id_fk FOREIGN KEY (invoice_header_id) REFERENCES invoice_headers (id) ON UPDATE
-    RESTRICT ON DELETE RESTRICT,
-    CONSTRAINT invoice_items_product_id_fk FOREIGN KEY 
-    (product_id) REFERENCES products (id) ON UPDATE RESTRICT ON DELETE RESTRICT
-	)`
-	mySQLCreateInvoiceItem = `INSERT  INTO invoice_items(invoice_header_id,product_id) VALUES (?,?)`
+	mySQLCreateInvoiceItem = `INSERT INTO invoice_items(invoice_header_id, product_id, quantity, unit_price, discount, total)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	mySQLGetInvoiceItemsByHeaderID = getInvoiceItems + " WHERE i.invoice_header_id = ? ORDER BY i.id"
+	mySQLGetAutoIncrement          = "SELECT @@innodb_autoinc_lock_mode, @@session.auto_increment_increment"
 )
 
 // MySQLInvoiceItem used to work with MySQL - invoice_items
 type MySQLInvoiceItem struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
-// NewMySQLInvoiceItem returns a new pointer of MySQLInvoiceItem
+// NewMySQLInvoiceItem returns a new pointer of MySQLInvoiceItem, it
+// prepares a statement per call. The storages of a Store reuse them
 func NewMySQLInvoiceItem(db *sql.DB) *MySQLInvoiceItem {
-	return &MySQLInvoiceItem{db}
+	return &MySQLInvoiceItem{db, uncachedStmts(db)}
 }
 
-// Migrate implements interface invoiceItem.storage
-func (p *MySQLInvoiceItem) Migrate() error {
-	fmt.Println("migrating....")
-	stmt, err := p.db.Prepare(mySQLMigrateInvoiceItem)
-	if err != nil {
-		return err
+// Migrate implements interface invoiceItem.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *MySQLInvoiceItem) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, MySQL, "invoice_items")
+}
+
+// CreateTx implements interface invoiceItem.storage, a missing product is a
+// *product.Error of kind ErrForeignKey. The items are inserted with a
+// statement per chunk of itemsPerInsert items when innodb_autoinc_lock_mode
+// is 0 or 1, the modes that give consecutive ids to the rows of a multi-row
+// insert, with the lock mode 2 (the default since MySQL 8) it inserts them
+// one by one
+func (p *MySQLInvoiceItem) CreateTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	if len(ms) == 0 {
+		return nil
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec()
+	var lockMode, increment uint
+	err := tx.QueryRowContext(ctx, mySQLGetAutoIncrement).Scan(&lockMode, &increment)
 	if err != nil {
-		return nil
+		return err
+	}
+	if lockMode > 1 || increment == 0 {
+		return p.createTxByRow(ctx, tx, headerID, ms)
 	}
 
-	fmt.Println("Migración de InvoiceItem ejecutada correctamente")
+	for _, chunk := range chunkItems(ms) {
+		if err := mySQLInsertInvoiceItemsTx(ctx, tx, headerID, chunk, increment); err != nil {
+			// MySQL does not say which product is missing
+			return itemProductError(0, err)
+		}
+	}
 	return nil
 }
 
-func (p *MySQLInvoiceItem) CreateTx(tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
-	stmt, err := tx.Prepare(mySQLCreateInvoiceItem)
+// createTxByRow inserts the items with a statement per item
+func (p *MySQLInvoiceItem) createTxByRow(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, mySQLCreateInvoiceItem)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, item := range ms {
-		result, err := stmt.Exec(headerID, item.ProductID)
+		result, err := stmt.ExecContext(
+			ctx,
+			headerID,
+			item.ProductID,
+			item.Quantity,
+			item.UnitPrice.Amount,
+			item.Discount.Amount,
+			item.Total.Amount,
+		)
 		if err != nil {
-			return err
+			return itemProductError(item.ProductID, err)
 		}
 
 		id, err := result.LastInsertId()
-		item.ID = uint(id)
-
 		if err != nil {
 			return err
 		}
+		item.ID = uint(id)
 	}
 	return nil
 }
+
+// mySQLInsertInvoiceItemsTx inserts ms and sets their ID. LastInsertId is
+// the id of the first row and, with innodb_autoinc_lock_mode 0 or 1, the
+// next rows take the next values of auto_increment_increment in the order
+// of VALUES, so the ids are first + i * increment
+func mySQLInsertInvoiceItemsTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models, increment uint) error {
+	query, args := insertInvoiceItems(questionPlaceholder, headerID, ms)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != int64(len(ms)) {
+		return fmt.Errorf("se insertaron %d items de %d", n, len(ms))
+	}
+
+	first, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i, item := range ms {
+		item.ID = uint(first) + uint(i)*increment
+	}
+	return nil
+}
+
+// GetByHeaderID implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *MySQLInvoiceItem) GetByHeaderID(ctx context.Context, headerID uint) (invoiceitem.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, mySQLGetInvoiceItemsByHeaderID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	rows, err := stmt.QueryContext(ctx, headerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(invoiceitem.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// GetByHeaderIDs implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *MySQLInvoiceItem) GetByHeaderIDs(ctx context.Context, headerIDs []uint) (invoiceitem.Models, error) {
+	ms := make(invoiceitem.Models, 0)
+	if len(headerIDs) == 0 {
+		return ms, nil
+	}
+
+	query, args := invoiceItemsByHeaderIDs(questionPlaceholder, headerIDs)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
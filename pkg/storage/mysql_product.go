@@ -1,71 +1,59 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/eltaljohn/go-db/pkg/product"
+	"time"
 )
 
 const (
-	mySQLMigrateProduct = `
-	CREATE TABLE IF NOT EXISTS products(
-	id INT AUTO_INCREMENT NOT NULL PRIMARY KEY,
-	name VARCHAR(25) NOT NULL,
-	observation VARCHAR(100),
-	price INT NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP
-	)`
-	mySQLCreateProduct  = `INSERT INTO products(name, observation, price, created_at) VALUES (?, ?, ?, ?)`
-	mySQLGetAllProduct  = `SELECT id, name, observation, price, created_at, updated_at from products`
-	mySQLGetProductByID = mySQLGetAllProduct + " WHERE id = ?"
-	mySQLUpdateProduct  = `UPDATE products SET name = ?, observation = ?, price = ?, updated_at = ? WHERE id = ?`
-	mySQLDeleteProduct  = "DELETE FROM products WHERE id = ?"
+	mySQLCreateProduct = `INSERT INTO products(name, observation, price_amount, price_currency, created_at) VALUES (?, ?, ?, ?, ?)`
+	mySQLGetAllProduct = `SELECT id, name, observation, price_amount, price_currency, created_at, updated_at, deleted_at,
+	version FROM products`
+	mySQLGetProductByID    = mySQLGetAllProduct + " WHERE id = ?"
+	mySQLGetProductVersion = "SELECT version FROM products WHERE id = ?"
+	mySQLUpdateProduct     = `UPDATE products SET name = ?, observation = ?, price_amount = ?, price_currency = ?, updated_at = ?,
+	version = version + 1 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`
+	mySQLDeleteProduct  = "UPDATE products SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL"
+	mySQLRestoreProduct = "UPDATE products SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL"
 )
 
 // mySQLProduct used to work with mySQL - product
 type mySQLProduct struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
 // NewMySQLProduct returns a new pointer of mySQLProduct
-func newMySQLProduct(db *sql.DB) *mySQLProduct {
-	return &mySQLProduct{db}
+func newMySQLProduct(db *sql.DB, stmts *stmtCache) *mySQLProduct {
+	return &mySQLProduct{db, stmts}
 }
 
-// Migrate implements interface product.storage
-func (p *mySQLProduct) Migrate() error {
-	stmt, err := p.db.Prepare(mySQLMigrateProduct)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
-	if err != nil {
-		return nil
-	}
-
-	fmt.Println("Migración de producto ejecutada correctamente")
-	return nil
+// Migrate implements interface product.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *mySQLProduct) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, MySQL, "products")
 }
 
 // Create implements interface product.storage
-func (p *mySQLProduct) Create(m *product.Model) error {
-	stmt, err := p.db.Prepare(mySQLCreateProduct)
+func (p *mySQLProduct) Create(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, mySQLCreateProduct)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	result, err := stmt.Exec(
+	result, err := stmt.ExecContext(
+		ctx,
 		m.Name,
 		stringToNull(m.Observations),
-		m.Price,
+		m.Price.Amount,
+		m.Price.Currency,
 		m.CreatedAt,
 	)
 	if err != nil {
-		return err
+		return productError(0, err)
 	}
 	id, err := result.LastInsertId()
 	if err != nil {
@@ -73,19 +61,48 @@ func (p *mySQLProduct) Create(m *product.Model) error {
 	}
 	m.ID = uint(id)
 
-	fmt.Printf("Se creó producto correctamente con ID: %d\n", m.ID)
+	// MySQL has no RETURNING, the version is the default of the column
+	if err := p.db.QueryRowContext(ctx, mySQLGetProductVersion, m.ID).Scan(&m.Version); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // GetAll implements interface product.storage
-func (p *mySQLProduct) GetAll() (product.Models, error) {
-	stmt, err := p.db.Prepare(mySQLGetAllProduct)
+func (p *mySQLProduct) GetAll(ctx context.Context) (product.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, mySQLGetAllProduct+notDeleted(ctx, " WHERE "))
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
+	defer rows.Close()
+
+	ms := make(product.Models, 0)
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	rows, err := stmt.Query()
+	return ms, nil
+}
+
+// List implements interface product.storage
+func (p *mySQLProduct) List(ctx context.Context, o product.ListOptions) (product.Models, error) {
+	query, args := listProducts(questionPlaceholder, plainTimestampCmp, mySQLGetAllProduct, o, product.IncludeDeleted(ctx))
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -107,71 +124,152 @@ func (p *mySQLProduct) GetAll() (product.Models, error) {
 	return ms, nil
 }
 
+// Each implements interface product.storage, the rows are scanned as
+// they arrive
+func (p *mySQLProduct) Each(ctx context.Context, fn func(*product.Model) error) error {
+	rows, err := p.db.QueryContext(ctx, mySQLGetAllProduct+notDeleted(ctx, " WHERE ")+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetByID implements interface product.storage
-func (p *mySQLProduct) GetByID(id uint) (*product.Model, error) {
-	stmt, err := p.db.Prepare(mySQLGetProductByID)
+func (p *mySQLProduct) GetByID(ctx context.Context, id uint) (*product.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, mySQLGetProductByID+notDeleted(ctx, " AND "))
 	if err != nil {
-		return &product.Model{}, err
+		return nil, err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	return scanRowProduct(stmt.QueryRow(id))
+	m, err := scanRowProduct(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, productError(id, err)
+	}
+
+	return m, nil
 }
 
 // Update implements interface product.storage
-func (p *mySQLProduct) Update(m *product.Model) error {
-	stmt, err := p.db.Prepare(mySQLUpdateProduct)
+func (p *mySQLProduct) Update(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, mySQLUpdateProduct)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	res, err := stmt.Exec(
+	res, err := stmt.ExecContext(
+		ctx,
 		m.Name,
 		stringToNull(m.Observations),
-		m.Price,
+		m.Price.Amount,
+		m.Price.Currency,
 		timeToNull(m.UpdatedAt),
 		m.ID,
+		m.Version,
+		m.Version,
 	)
+	if err != nil {
+		return productError(m.ID, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return productUpdateError(ctx, p, m)
+	}
+	if m.Version != 0 {
+		m.Version++
+	}
+
+	return nil
+}
+
+// Patch implements interface product.storage
+func (p *mySQLProduct) Patch(ctx context.Context, id uint, patch product.Patch) error {
+	if patch.Empty() {
+		return product.ErrEmptyPatch
+	}
+
+	query, args := patchProduct(questionPlaceholder, id, patch, time.Now())
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return productError(id, err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no existe el producto con id: %d", m.ID)
+		return productUpdateError(ctx, p, &product.Model{ID: id, Version: patch.Version})
 	}
 
-	fmt.Println("Se actualizó el producto correctamente")
 	return nil
 }
 
-// Delete implements interface product.storage
-func (p *mySQLProduct) Delete(id uint) error {
-	stmt, err := p.db.Prepare(mySQLDeleteProduct)
+// Delete implements interface product.storage, it sets deleted_at
+func (p *mySQLProduct) Delete(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, mySQLDeleteProduct)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	res, err := stmt.Exec(id)
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return productNotFound(id)
+	}
+
+	return nil
+}
+
+// Restore implements interface product.storage
+func (p *mySQLProduct) Restore(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, mySQLRestoreProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no existe el producto con id: %d", id)
+		return productNotFound(id)
 	}
 
-	fmt.Println("Se eliminó el producto correctamente")
 	return nil
 }
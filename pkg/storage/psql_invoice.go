@@ -1,8 +1,8 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoice"
 	"github.com/eltaljohn/go-db/pkg/invoiceheader"
 	"github.com/eltaljohn/go-db/pkg/invoiceitem"
@@ -21,24 +21,31 @@ func NewPsqlInvoice(db *sql.DB, h invoiceheader.Storage, i invoiceitem.Storage)
 }
 
 // Create implements interface invoice.Storage
-func (p *PsqlInvoice) Create(m *invoice.Model) error {
-	tx, err := p.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	err = p.storageHeader.CreateTx(tx, m.Header)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	fmt.Printf("Factura creada con id: %d \n", m.Header.ID)
-
-	if err := p.storageItems.CreateTx(tx, m.Header.ID, m.Items); err != nil {
-		tx.Rollback()
-		return err
-	}
-	fmt.Printf("Items creados: %d \n", len(m.Items))
-
-	return tx.Commit()
+func (p *PsqlInvoice) Create(ctx context.Context, m *invoice.Model) error {
+	return createInvoice(ctx, p.db, p.storageHeader, p.storageItems, m)
+}
+
+// GetByID implements interface invoice.Storage
+func (p *PsqlInvoice) GetByID(ctx context.Context, id uint) (*invoice.Model, error) {
+	return getInvoice(ctx, p.storageHeader, p.storageItems, id)
+}
+
+// List implements interface invoice.Storage
+func (p *PsqlInvoice) List(ctx context.Context, f invoiceheader.Filter) (invoice.Models, error) {
+	return listInvoices(ctx, p.storageHeader, p.storageItems, f)
+}
+
+// ChangeStatus implements interface invoice.Storage
+func (p *PsqlInvoice) ChangeStatus(ctx context.Context, c *invoiceheader.StatusChange) error {
+	return changeInvoiceStatus(ctx, p.db, p.storageHeader, p.storageItems, c, nil)
+}
+
+// Cancel implements interface invoice.Storage
+func (p *PsqlInvoice) Cancel(ctx context.Context, c *invoiceheader.StatusChange, creditNote *invoice.Model) error {
+	return changeInvoiceStatus(ctx, p.db, p.storageHeader, p.storageItems, c, creditNote)
+}
+
+// StatusHistory implements interface invoice.Storage
+func (p *PsqlInvoice) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	return p.storageHeader.StatusHistory(ctx, id)
 }
@@ -1,56 +1,154 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoiceheader"
 )
 
-// psqlMigrateInvoiceHeader cons to create invoice_headers table
 const (
-	psqlMigrateInvoiceHeader = `CREATE TABLE IF NOT EXISTS invoice_headers(
-	id SERIAL NOT NULL,
-	client VARCHAR(25) NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP,
-	CONSTRAINT invoice_headers_id_pk PRIMARY KEY (id)
-)`
-	psqlCreateInvoiceHeader = `INSERT INTO invoice_headers(client) VALUES ($1) RETURNING id, created_at`
+	psqlCreateInvoiceHeader = `INSERT INTO invoice_headers(client, status, kind, reference_id, currency, subtotal, tax, total)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`
+	psqlGetInvoiceHeaderByID      = getAllInvoiceHeaders + " WHERE id = $1"
+	psqlUpdateInvoiceHeaderStatus = `UPDATE invoice_headers SET status = $1, updated_at = $2
+	WHERE id = $3 AND status = $4`
+	psqlCreateInvoiceStatusChange = `INSERT INTO invoice_status_changes(invoice_header_id, from_status, to_status, reason, created_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	psqlGetInvoiceStatusChanges = getAllInvoiceStatusChanges + " WHERE invoice_header_id = $1 ORDER BY id"
 )
 
 // PsqlInvoiceHeader used to work with postgres - invoice_headers
 type PsqlInvoiceHeader struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
-// NewPsqlInvoiceHeader returns a new pointer of PsqlInvoiceHeader
+// NewPsqlInvoiceHeader returns a new pointer of PsqlInvoiceHeader, it
+// prepares a statement per call. The storages of a Store reuse them
 func NewPsqlInvoiceHeader(db *sql.DB) *PsqlInvoiceHeader {
-	return &PsqlInvoiceHeader{db}
+	return &PsqlInvoiceHeader{db, uncachedStmts(db)}
 }
 
-// Migrate implements interface invoiceHeader.storage
-func (p *PsqlInvoiceHeader) Migrate() error {
-	stmt, err := p.db.Prepare(psqlMigrateInvoiceHeader)
+// Migrate implements interface invoiceHeader.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *PsqlInvoiceHeader) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, Postgres, "invoice_headers")
+}
+
+func (p *PsqlInvoiceHeader) CreateTx(ctx context.Context, tx *sql.Tx, m *invoiceheader.Model) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, psqlCreateInvoiceHeader)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec()
+	return stmt.QueryRowContext(
+		ctx,
+		m.Client,
+		m.Status,
+		m.Kind,
+		uintToNull(m.ReferenceID),
+		m.Currency,
+		m.Subtotal.Amount,
+		m.Tax.Amount,
+		m.Total.Amount,
+	).Scan(&m.ID, &m.CreateAt)
+}
+
+// GetByID implements interface invoiceHeader.storage
+func (p *PsqlInvoiceHeader) GetByID(ctx context.Context, id uint) (*invoiceheader.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, psqlGetInvoiceHeaderByID)
+	if err != nil {
+		return &invoiceheader.Model{}, err
+	}
+	defer p.stmts.release(stmt)
+
+	return scanRowInvoiceHeader(stmt.QueryRowContext(ctx, id))
+}
+
+// List implements interface invoiceHeader.storage
+func (p *PsqlInvoiceHeader) List(ctx context.Context, f invoiceheader.Filter) (invoiceheader.Models, error) {
+	query, args := listInvoiceHeaders(psqlPlaceholder, psqlTimestampCmp, f)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	fmt.Println("Migración de InvoiceHeader ejecutada correctamente")
-	return nil
+	ms := make(invoiceheader.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceHeader(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
 }
 
-func (p *PsqlInvoiceHeader) CreateTx(tx *sql.Tx, m *invoiceheader.Model) error {
-	stmt, err := tx.Prepare(psqlCreateInvoiceHeader)
+// ChangeStatusTx implements interface invoiceHeader.storage, the update
+// only matches while the invoice keeps the status c.From
+func (p *PsqlInvoiceHeader) ChangeStatusTx(ctx context.Context, tx *sql.Tx, c *invoiceheader.StatusChange) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, psqlUpdateInvoiceHeaderStatus)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, c.To, c.CreatedAt, c.InvoiceHeaderID, c.From)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return invoiceheader.ErrStatusChanged
+	}
+
+	stmt, err = p.stmts.prepareTx(ctx, tx, psqlCreateInvoiceStatusChange)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	return stmt.QueryRow(m.Client).Scan(&m.ID, &m.CreateAt)
+	return stmt.QueryRowContext(
+		ctx,
+		c.InvoiceHeaderID,
+		c.From,
+		c.To,
+		stringToNull(c.Reason),
+		c.CreatedAt,
+	).Scan(&c.ID)
+}
+
+// StatusHistory implements interface invoiceHeader.storage
+func (p *PsqlInvoiceHeader) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	rows, err := p.db.QueryContext(ctx, psqlGetInvoiceStatusChanges, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cs := make(invoiceheader.StatusChanges, 0)
+	for rows.Next() {
+		c, err := scanRowStatusChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
 }
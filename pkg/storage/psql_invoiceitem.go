@@ -1,68 +1,139 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"time"
 )
 
-// psqlMigrateInvoiceItem cons to create invoice_items table
 const (
-	psqlMigrateInvoiceItem = `CREATE TABLE IF NOT EXISTS invoice_items(
-	id SERIAL NOT NULL,
-	invoice_header_id INT NOT NULL,
-	product_id INT NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP,
-	CONSTRAINT invoice_items_id_pk PRIMARY KEY (id),
-    CONSTRAINT invoice_items_invoice_header_id_fk FOREIGN KEY (invoice_header_id) REFERENCES invoice_headers (id) ON UPDATE
-    RESTRICT ON DELETE RESTRICT,
-    CONSTRAINT invoice_items_product_id_fk FOREIGN KEY 
-    (product_id) REFERENCES products (id) ON UPDATE RESTRICT ON DELETE RESTRICT
-)`
-	psqlCreateInvoiceItem = `INSERT  INTO invoice_items(invoice_header_id,product_id) VALUES ($1,$2) RETURNING id, created_at`
+	psqlGetInvoiceItemsByHeaderID = getInvoiceItems + " WHERE i.invoice_header_id = $1 ORDER BY i.id"
 )
 
 // PsqlInvoiceItem used to work with postgres - invoice_headers
 type PsqlInvoiceItem struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
-// NewPsqlInvoiceItem returns a new pointer of PsqlInvoiceItem
+// NewPsqlInvoiceItem returns a new pointer of PsqlInvoiceItem, it
+// prepares a statement per call. The storages of a Store reuse them
 func NewPsqlInvoiceItem(db *sql.DB) *PsqlInvoiceItem {
-	return &PsqlInvoiceItem{db}
+	return &PsqlInvoiceItem{db, uncachedStmts(db)}
 }
 
-// Migrate implements interface invoiceItem.storage
-func (p *PsqlInvoiceItem) Migrate() error {
-	fmt.Println("migrating....")
-	stmt, err := p.db.Prepare(psqlMigrateInvoiceItem)
+// Migrate implements interface invoiceItem.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *PsqlInvoiceItem) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, Postgres, "invoice_items")
+}
+
+// CreateTx implements interface invoiceItem.storage, the items are inserted
+// with a statement per chunk of itemsPerInsert items. A missing product is
+// a *product.Error of kind ErrForeignKey
+func (p *PsqlInvoiceItem) CreateTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	for _, chunk := range chunkItems(ms) {
+		if err := psqlInsertInvoiceItemsTx(ctx, tx, headerID, chunk); err != nil {
+			return itemProductError(pqMissingProductID(err), err)
+		}
+	}
+	return nil
+}
+
+// psqlInsertInvoiceItemsTx inserts ms and sets their ID and CreatedAt, each
+// row comes back with the ordinal of its item in ms
+func psqlInsertInvoiceItemsTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	query, args := psqlInsertInvoiceItems(headerID, ms)
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	_, err = stmt.Exec()
-	if err != nil {
-		return nil
+	n := 0
+	for rows.Next() {
+		var ord int
+		var id uint
+		var createdAt time.Time
+		if err := rows.Scan(&ord, &id, &createdAt); err != nil {
+			return err
+		}
+		if ord < 0 || ord >= len(ms) {
+			return fmt.Errorf("ordinal de item inválido: %d", ord)
+		}
+		ms[ord].ID = id
+		ms[ord].CreatedAt = createdAt
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	fmt.Println("Migración de InvoiceItem ejecutada correctamente")
+	if n != len(ms) {
+		return fmt.Errorf("se insertaron %d items de %d", n, len(ms))
+	}
 	return nil
 }
 
-func (p *PsqlInvoiceItem) CreateTx(tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
-	stmt, err := tx.Prepare(psqlCreateInvoiceItem)
+// GetByHeaderID implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *PsqlInvoiceItem) GetByHeaderID(ctx context.Context, headerID uint) (invoiceitem.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, psqlGetInvoiceItemsByHeaderID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	rows, err := stmt.QueryContext(ctx, headerID)
+	if err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	for _, item := range ms {
-		err = stmt.QueryRow(headerID, item.ProductID).Scan(&item.ID, &item.CreatedAt)
+	ms := make(invoiceitem.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		ms = append(ms, m)
 	}
-	return nil
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// GetByHeaderIDs implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *PsqlInvoiceItem) GetByHeaderIDs(ctx context.Context, headerIDs []uint) (invoiceitem.Models, error) {
+	ms := make(invoiceitem.Models, 0)
+	if len(headerIDs) == 0 {
+		return ms, nil
+	}
+
+	query, args := invoiceItemsByHeaderIDs(psqlPlaceholder, headerIDs)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
 }
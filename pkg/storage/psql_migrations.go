@@ -0,0 +1,168 @@
+package storage
+
+import "github.com/eltaljohn/go-db/pkg/migrate"
+
+// psqlMigrations versioned schema of postgres, a released migration must
+// not change, add a new one instead
+var psqlMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "create_products",
+		Up: []string{`CREATE TABLE IF NOT EXISTS products(
+	id SERIAL NOT NULL,
+	name VARCHAR(25) NOT NULL,
+	observation VARCHAR(100),
+	price INT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP,
+	CONSTRAINT products_id_pk PRIMARY KEY (id)
+)`},
+		Down: []string{`DROP TABLE products`},
+	},
+	{
+		Version: 2,
+		Name:    "create_invoice_headers",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_headers(
+	id SERIAL NOT NULL,
+	client VARCHAR(25) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP,
+	CONSTRAINT invoice_headers_id_pk PRIMARY KEY (id)
+)`},
+		Down: []string{`DROP TABLE invoice_headers`},
+	},
+	{
+		Version: 3,
+		Name:    "create_invoice_items",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_items(
+	id SERIAL NOT NULL,
+	invoice_header_id INT NOT NULL,
+	product_id INT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP,
+	CONSTRAINT invoice_items_id_pk PRIMARY KEY (id),
+	CONSTRAINT invoice_items_invoice_header_id_fk FOREIGN KEY (invoice_header_id)
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT,
+	CONSTRAINT invoice_items_product_id_fk FOREIGN KEY (product_id)
+	REFERENCES products (id) ON UPDATE RESTRICT ON DELETE RESTRICT
+)`},
+		Down: []string{`DROP TABLE invoice_items`},
+	},
+	{
+		Version: 4,
+		Name:    "add_invoice_items_amounts",
+		Up: []string{`ALTER TABLE invoice_items
+	ADD COLUMN quantity INT NOT NULL DEFAULT 1,
+	ADD COLUMN unit_price INT NOT NULL DEFAULT 0,
+	ADD COLUMN discount INT NOT NULL DEFAULT 0,
+	ADD COLUMN total INT NOT NULL DEFAULT 0`},
+		Down: []string{`ALTER TABLE invoice_items
+	DROP COLUMN quantity,
+	DROP COLUMN unit_price,
+	DROP COLUMN discount,
+	DROP COLUMN total`},
+	},
+	{
+		Version: 5,
+		Name:    "add_invoice_headers_totals",
+		Up: []string{`ALTER TABLE invoice_headers
+	ADD COLUMN subtotal INT NOT NULL DEFAULT 0,
+	ADD COLUMN tax INT NOT NULL DEFAULT 0,
+	ADD COLUMN total INT NOT NULL DEFAULT 0`},
+		Down: []string{`ALTER TABLE invoice_headers
+	DROP COLUMN subtotal,
+	DROP COLUMN tax,
+	DROP COLUMN total`},
+	},
+	{
+		Version: 6,
+		Name:    "add_invoice_headers_status",
+		Up: []string{`ALTER TABLE invoice_headers
+	ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'issued',
+	ADD COLUMN kind VARCHAR(12) NOT NULL DEFAULT 'invoice',
+	ADD COLUMN reference_id INT,
+	ADD CONSTRAINT invoice_headers_reference_id_fk FOREIGN KEY (reference_id)
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT`},
+		Down: []string{`ALTER TABLE invoice_headers
+	DROP CONSTRAINT invoice_headers_reference_id_fk,
+	DROP COLUMN status,
+	DROP COLUMN kind,
+	DROP COLUMN reference_id`},
+	},
+	{
+		Version: 7,
+		Name:    "create_invoice_status_changes",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_status_changes(
+	id SERIAL NOT NULL,
+	invoice_header_id INT NOT NULL,
+	from_status VARCHAR(10) NOT NULL,
+	to_status VARCHAR(10) NOT NULL,
+	reason VARCHAR(255),
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	CONSTRAINT invoice_status_changes_id_pk PRIMARY KEY (id),
+	CONSTRAINT invoice_status_changes_invoice_header_id_fk FOREIGN KEY (invoice_header_id)
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT
+)`},
+		Down: []string{`DROP TABLE invoice_status_changes`},
+	},
+	{
+		Version: 8,
+		Name:    "products_price_money",
+		Up: []string{
+			`ALTER TABLE products
+	ADD COLUMN price_amount BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN price_currency CHAR(3) NOT NULL DEFAULT 'USD'`,
+			`UPDATE products SET price_amount = price * 100`,
+			`ALTER TABLE products DROP COLUMN price`,
+		},
+		Down: []string{
+			`ALTER TABLE products ADD COLUMN price INT NOT NULL DEFAULT 0`,
+			`UPDATE products SET price = price_amount / 100`,
+			`ALTER TABLE products
+	DROP COLUMN price_amount,
+	DROP COLUMN price_currency`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "invoices_money",
+		Up: []string{
+			`ALTER TABLE invoice_headers
+	ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD',
+	ALTER COLUMN subtotal TYPE BIGINT,
+	ALTER COLUMN tax TYPE BIGINT,
+	ALTER COLUMN total TYPE BIGINT`,
+			`UPDATE invoice_headers SET subtotal = subtotal * 100, tax = tax * 100, total = total * 100`,
+			`ALTER TABLE invoice_items
+	ALTER COLUMN unit_price TYPE BIGINT,
+	ALTER COLUMN discount TYPE BIGINT,
+	ALTER COLUMN total TYPE BIGINT`,
+			`UPDATE invoice_items SET unit_price = unit_price * 100, discount = discount * 100, total = total * 100`,
+		},
+		Down: []string{
+			`UPDATE invoice_items SET unit_price = unit_price / 100, discount = discount / 100, total = total / 100`,
+			`ALTER TABLE invoice_items
+	ALTER COLUMN unit_price TYPE INT,
+	ALTER COLUMN discount TYPE INT,
+	ALTER COLUMN total TYPE INT`,
+			`UPDATE invoice_headers SET subtotal = subtotal / 100, tax = tax / 100, total = total / 100`,
+			`ALTER TABLE invoice_headers
+	DROP COLUMN currency,
+	ALTER COLUMN subtotal TYPE INT,
+	ALTER COLUMN tax TYPE INT,
+	ALTER COLUMN total TYPE INT`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_products_deleted_at",
+		Up:      []string{`ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP`},
+		Down:    []string{`ALTER TABLE products DROP COLUMN deleted_at`},
+	},
+	{
+		Version: 11,
+		Name:    "add_products_version",
+		Up:      []string{`ALTER TABLE products ADD COLUMN version INT NOT NULL DEFAULT 1`},
+		Down:    []string{`ALTER TABLE products DROP COLUMN version`},
+	},
+}
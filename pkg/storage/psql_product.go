@@ -1,89 +1,73 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/eltaljohn/go-db/pkg/product"
+	"time"
 )
 
-// psqlMigrateProduct cons to create products table
 const (
-	psqlMigrateProduct = `
-	CREATE TABLE IF NOT EXISTS products(
-	id SERIAL NOT NULL,
-	name VARCHAR(25) NOT NULL,
-	observation VARCHAR(100),
-	price INT NOT NULL,
-	created_at TIMESTAMP NOT NULL DEFAULT now(),
-	updated_at TIMESTAMP
-	CONSTRAINT products_id_pk PRIMARY KEY (id)
-	)`
-	psqlCreateProduct = `INSERT INTO products(name, observation, price, created_at) 
-	VALUES ($1, $2, $3, $4) RETURNING id`
-	psqlGetAllProduct  = `SELECT id, name, observation, price, created_at, updated_at from products`
+	psqlCreateProduct = `INSERT INTO products(name, observation, price_amount, price_currency, created_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, version`
+	psqlGetAllProduct = `SELECT id, name, observation, price_amount, price_currency, created_at, updated_at, deleted_at,
+	version FROM products`
 	psqlGetProductByID = psqlGetAllProduct + " WHERE id = $1"
-	psqlUpdateProduct  = `UPDATE products SET name = $1, observation = $2, price = $3, updated_at = $4 WHERE id = $5`
-	psqlDeleteProduct  = "DELETE FROM products WHERE id = $1"
+	psqlUpdateProduct  = `UPDATE products SET name = $1, observation = $2, price_amount = $3, price_currency = $4, updated_at = $5,
+	version = version + 1 WHERE id = $6 AND deleted_at IS NULL AND ($7 = 0 OR version = $8)`
+	psqlDeleteProduct  = "UPDATE products SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL"
+	psqlRestoreProduct = "UPDATE products SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NOT NULL"
 )
 
 // psqlProduct used to work with postgres - product
 type psqlProduct struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
 // newPsqlProduct returns a new pointer of psqlProduct
-func newPsqlProduct(db *sql.DB) *psqlProduct {
-	return &psqlProduct{db}
+func newPsqlProduct(db *sql.DB, stmts *stmtCache) *psqlProduct {
+	return &psqlProduct{db, stmts}
 }
 
-// Migrate implements interface product.storage
-func (p *psqlProduct) Migrate() error {
-	stmt, err := p.db.Prepare(psqlMigrateProduct)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
-	if err != nil {
-		return nil
-	}
-
-	fmt.Println("Migración de producto ejecutada correctamente")
-	return nil
+// Migrate implements interface product.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *psqlProduct) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, Postgres, "products")
 }
 
 // Create implements interface product.storage
-func (p *psqlProduct) Create(m *product.Model) error {
-	stmt, err := p.db.Prepare(psqlCreateProduct)
+func (p *psqlProduct) Create(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, psqlCreateProduct)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	err = stmt.QueryRow(
+	err = stmt.QueryRowContext(
+		ctx,
 		m.Name,
 		stringToNull(m.Observations),
-		m.Price,
+		m.Price.Amount,
+		m.Price.Currency,
 		m.CreatedAt,
-	).Scan(&m.ID)
+	).Scan(&m.ID, &m.Version)
 	if err != nil {
-		return err
+		return productError(0, err)
 	}
 
-	fmt.Println("Se creó producto correctamente")
 	return nil
 }
 
 // GetAll implements interface product.storage
-func (p *psqlProduct) GetAll() (product.Models, error) {
-	stmt, err := p.db.Prepare(psqlGetAllProduct)
+func (p *psqlProduct) GetAll(ctx context.Context) (product.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, psqlGetAllProduct+notDeleted(ctx, " WHERE "))
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	rows, err := stmt.Query()
+	rows, err := stmt.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -105,61 +89,168 @@ func (p *psqlProduct) GetAll() (product.Models, error) {
 	return ms, nil
 }
 
+// List implements interface product.storage
+func (p *psqlProduct) List(ctx context.Context, o product.ListOptions) (product.Models, error) {
+	query, args := listProducts(psqlPlaceholder, psqlTimestampCmp, psqlGetAllProduct, o, product.IncludeDeleted(ctx))
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(product.Models, 0)
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// Each implements interface product.storage, the rows are scanned as
+// they arrive
+func (p *psqlProduct) Each(ctx context.Context, fn func(*product.Model) error) error {
+	rows, err := p.db.QueryContext(ctx, psqlGetAllProduct+notDeleted(ctx, " WHERE ")+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetByID implements interface product.storage
-func (p *psqlProduct) GetByID(id uint) (*product.Model, error) {
-	stmt, err := p.db.Prepare(psqlGetProductByID)
+func (p *psqlProduct) GetByID(ctx context.Context, id uint) (*product.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, psqlGetProductByID+notDeleted(ctx, " AND "))
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	m, err := scanRowProduct(stmt.QueryRowContext(ctx, id))
 	if err != nil {
-		return &product.Model{}, err
+		return nil, productError(id, err)
 	}
-	defer stmt.Close()
 
-	return scanRowProduct(stmt.QueryRow(id))
+	return m, nil
 }
 
 // Update implements interface product.storage
-func (p *psqlProduct) Update(m *product.Model) error {
-	stmt, err := p.db.Prepare(psqlUpdateProduct)
+func (p *psqlProduct) Update(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, psqlUpdateProduct)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer p.stmts.release(stmt)
 
-	res, err := stmt.Exec(
+	res, err := stmt.ExecContext(
+		ctx,
 		m.Name,
 		stringToNull(m.Observations),
-		m.Price,
+		m.Price.Amount,
+		m.Price.Currency,
 		timeToNull(m.UpdatedAt),
 		m.ID,
+		m.Version,
+		m.Version,
 	)
+	if err != nil {
+		return productError(m.ID, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return productUpdateError(ctx, p, m)
+	}
+	if m.Version != 0 {
+		m.Version++
+	}
+
+	return nil
+}
+
+// Patch implements interface product.storage
+func (p *psqlProduct) Patch(ctx context.Context, id uint, patch product.Patch) error {
+	if patch.Empty() {
+		return product.ErrEmptyPatch
+	}
+
+	query, args := patchProduct(psqlPlaceholder, id, patch, time.Now())
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return productError(id, err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no existe el producto con id: %d", m.ID)
+		return productUpdateError(ctx, p, &product.Model{ID: id, Version: patch.Version})
 	}
 
-	fmt.Println("Se actualizó el producto correctamente")
 	return nil
 }
 
-// Delete implements interface product.storage
-func (p *psqlProduct) Delete(id uint) error {
-	stmt, err := p.db.Prepare(psqlDeleteProduct)
+// Delete implements interface product.storage, it sets deleted_at
+func (p *psqlProduct) Delete(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, psqlDeleteProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(id)
+	if rowsAffected == 0 {
+		return productNotFound(id)
+	}
+
+	return nil
+}
+
+// Restore implements interface product.storage
+func (p *psqlProduct) Restore(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, psqlRestoreProduct)
 	if err != nil {
 		return err
 	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
@@ -167,9 +258,8 @@ func (p *psqlProduct) Delete(id uint) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no existe el producto con id: %d", id)
+		return productNotFound(id)
 	}
 
-	fmt.Println("Se eliminó el producto correctamente")
 	return nil
 }
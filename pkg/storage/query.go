@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"strings"
+	"time"
+)
+
+// placeholder returns the n-th (from 1) bind parameter of a dialect
+type placeholder func(n int) string
+
+// psqlPlaceholder $1, $2...
+func psqlPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// questionPlaceholder ? used by MySQL and SQLite
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// query builds a statement binding its arguments with the placeholders of
+// a dialect
+type query struct {
+	ph    placeholder
+	where []string
+	args  []interface{}
+}
+
+// arg adds an argument and returns its placeholder
+func (q *query) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return q.ph(len(q.args))
+}
+
+// and adds a condition, %s in cond are replaced by the placeholders of args
+func (q *query) and(cond string, args ...interface{}) {
+	phs := make([]interface{}, len(args))
+	for i, a := range args {
+		phs[i] = q.arg(a)
+	}
+	q.where = append(q.where, fmt.Sprintf(cond, phs...))
+}
+
+// whereClause returns the WHERE clause, empty without conditions
+func (q *query) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.where, " AND ")
+}
+
+// likeEscaper escapes the wildcards of LIKE, the queries use ESCAPE '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// containsPattern returns a LIKE pattern matching s as a substring
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(s)) + "%"
+}
+
+// limit returns the limit of a page, def when it is not positive and max
+// when it is greater, so the queries of a page stay bounded
+func limit(l, def, max int) int {
+	switch {
+	case l <= 0:
+		return def
+	case l > max:
+		return max
+	default:
+		return l
+	}
+}
+
+// timestampCmp returns the condition comparing a TIMESTAMP column with a
+// parameter, op is the operator and param the placeholder
+type timestampCmp func(column, op, param string) string
+
+// psqlTimestampCmp casts the parameter to timestamptz, so the column,
+// written by now() in the time zone of the session, is compared in that
+// zone instead of as UTC
+func psqlTimestampCmp(column, op, param string) string {
+	return column + " " + op + " " + param + "::timestamptz"
+}
+
+// sqliteTimestampCmp compares the julian days, the column and the
+// parameter are texts that can have different formats and time zones
+func sqliteTimestampCmp(column, op, param string) string {
+	return "julianday(" + column + ") " + op + " julianday(" + param + ")"
+}
+
+// plainTimestampCmp compares the column with the parameter as they are
+func plainTimestampCmp(column, op, param string) string {
+	return column + " " + op + " " + param
+}
+
+// listInvoiceHeaders builds the query of invoiceheader.Storage.List, ts
+// compares created_at with the dates of the filter
+func listInvoiceHeaders(ph placeholder, ts timestampCmp, f invoiceheader.Filter) (string, []interface{}) {
+	q := &query{ph: ph}
+	if f.Client != "" {
+		q.and("LOWER(client) LIKE %s ESCAPE '!'", containsPattern(f.Client))
+	}
+	if !f.From.IsZero() {
+		q.and(ts("created_at", ">=", "%s"), f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		q.and(ts("created_at", "<", "%s"), f.To.UTC())
+	}
+	if f.Status != "" {
+		q.and("status = %s", f.Status)
+	}
+
+	stmt := getAllInvoiceHeaders + q.whereClause() +
+		" ORDER BY created_at DESC, id DESC" +
+		" LIMIT " + q.arg(limit(f.Limit, invoiceheader.DefaultLimit, invoiceheader.MaxLimit)) +
+		" OFFSET " + q.arg(f.Offset)
+
+	return stmt, q.args
+}
+
+// invoiceItemsByHeaderIDs builds the query of the items of the headers of
+// ids, it must not be empty
+func invoiceItemsByHeaderIDs(ph placeholder, ids []uint) (string, []interface{}) {
+	q := &query{ph: ph}
+	phs := make([]string, len(ids))
+	for i, id := range ids {
+		phs[i] = q.arg(id)
+	}
+
+	return getInvoiceItems + " WHERE i.invoice_header_id IN (" + strings.Join(phs, ", ") + ")" +
+		" ORDER BY i.invoice_header_id, i.id", q.args
+}
+
+// productSortColumns are the columns of every product.Sort, the sort is
+// never written in a query from the options
+var productSortColumns = map[product.Sort]string{
+	"":                    "id",
+	product.SortID:        "id",
+	product.SortName:      "name",
+	product.SortPrice:     "price_amount",
+	product.SortCreatedAt: "created_at",
+}
+
+// cursorValue returns the value of the sort column in c, created_at is
+// compared by listProducts with the timestampCmp of the driver
+func cursorValue(s product.Sort, c *product.Cursor) interface{} {
+	switch s {
+	case product.SortName:
+		return c.Name
+	case product.SortPrice:
+		return c.Price
+	default:
+		return c.ID
+	}
+}
+
+// listProducts builds the query of product.Storage.List from getAll, the
+// select of every product of a driver, ts compares created_at with the
+// cursor. The options must be valid
+func listProducts(ph placeholder, ts timestampCmp, getAll string, o product.ListOptions, withDeleted bool) (string, []interface{}) {
+	q := &query{ph: ph}
+	if !withDeleted {
+		q.and("deleted_at IS NULL")
+	}
+	if o.Name != "" {
+		q.and("LOWER(name) LIKE %s ESCAPE '!'", containsPattern(o.Name))
+	}
+	if o.MinPrice != nil {
+		q.and("price_currency = %s AND price_amount >= %s", o.MinPrice.Currency, o.MinPrice.Amount)
+	}
+	if o.MaxPrice != nil {
+		q.and("price_currency = %s AND price_amount <= %s", o.MaxPrice.Currency, o.MaxPrice.Amount)
+	}
+
+	column, dir, cmp := productSortColumns[o.Sort], "ASC", ">"
+	if o.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	// keyset pagination, the rows after the cursor in the order of the list
+	if o.After != nil {
+		switch column {
+		case "id":
+			q.and("id "+cmp+" %s", o.After.ID)
+		case "created_at":
+			v := o.After.CreatedAt.UTC()
+			q.and("("+ts(column, cmp, "%s")+" OR ("+ts(column, "=", "%s")+" AND id "+cmp+" %s))", v, v, o.After.ID)
+		default:
+			v := cursorValue(o.Sort, o.After)
+			q.and(fmt.Sprintf("(%[1]s %[2]s %%s OR (%[1]s = %%s AND id %[2]s %%s))", column, cmp), v, v, o.After.ID)
+		}
+	}
+
+	order := " ORDER BY " + column + " " + dir
+	if column != "id" {
+		order += ", id " + dir
+	}
+
+	stmt := getAll + q.whereClause() + order +
+		" LIMIT " + q.arg(limit(o.Limit, product.DefaultLimit, product.MaxLimit)) +
+		" OFFSET " + q.arg(o.Offset)
+
+	return stmt, q.args
+}
+
+// patchProduct builds the UPDATE of product.Storage.Patch, only the fields
+// set in p are in the SET clause. The patch must not be empty
+func patchProduct(ph placeholder, id uint, p product.Patch, updatedAt time.Time) (string, []interface{}) {
+	q := &query{ph: ph}
+	set := make([]string, 0, 6)
+	if p.Name != nil {
+		set = append(set, "name = "+q.arg(*p.Name))
+	}
+	if p.Observations != nil {
+		set = append(set, "observation = "+q.arg(stringToNull(*p.Observations)))
+	}
+	if p.Price != nil {
+		set = append(set, "price_amount = "+q.arg(p.Price.Amount), "price_currency = "+q.arg(p.Price.Currency))
+	}
+	set = append(set, "updated_at = "+q.arg(updatedAt), "version = version + 1")
+
+	q.and("id = %s", id)
+	q.and("deleted_at IS NULL")
+	if p.Version != 0 {
+		q.and("version = %s", p.Version)
+	}
+
+	return "UPDATE products SET " + strings.Join(set, ", ") + q.whereClause(), q.args
+}
+
+// itemsPerInsert is the max number of rows of insertInvoiceItems, its 6
+// parameters per item stay far under the 65535 of postgres and mysql
+const itemsPerInsert = 1000
+
+// chunkItems splits ms in chunks of at most itemsPerInsert items
+func chunkItems(ms invoiceitem.Models) []invoiceitem.Models {
+	chunks := make([]invoiceitem.Models, 0, (len(ms)+itemsPerInsert-1)/itemsPerInsert)
+	for len(ms) > itemsPerInsert {
+		chunks = append(chunks, ms[:itemsPerInsert])
+		ms = ms[itemsPerInsert:]
+	}
+	if len(ms) > 0 {
+		chunks = append(chunks, ms)
+	}
+	return chunks
+}
+
+// insertInvoiceItems builds the INSERT of the items of a header as a single
+// statement with a row per item, in the order of ms
+func insertInvoiceItems(ph placeholder, headerID uint, ms invoiceitem.Models) (string, []interface{}) {
+	q := &query{ph: ph}
+	rows := make([]string, len(ms))
+	for i, item := range ms {
+		rows[i] = fmt.Sprintf("(%s, %s, %s, %s, %s, %s)",
+			q.arg(headerID),
+			q.arg(item.ProductID),
+			q.arg(item.Quantity),
+			q.arg(item.UnitPrice.Amount),
+			q.arg(item.Discount.Amount),
+			q.arg(item.Total.Amount),
+		)
+	}
+
+	return `INSERT INTO invoice_items(invoice_header_id, product_id, quantity, unit_price, discount, total)
+	VALUES ` + strings.Join(rows, ", "), q.args
+}
+
+// psqlInsertInvoiceItems builds the INSERT of the items of a header for
+// postgres. The order of the rows of RETURNING is not documented, so every
+// item takes its id from the sequence next to its ordinal in ms and the
+// query returns the ordinal, the id and the created_at of each row
+func psqlInsertInvoiceItems(headerID uint, ms invoiceitem.Models) (string, []interface{}) {
+	q := &query{ph: psqlPlaceholder}
+	header := q.arg(headerID)
+	rows := make([]string, len(ms))
+	for i, item := range ms {
+		rows[i] = fmt.Sprintf("(%d, %s::int, %s::int, %s::bigint, %s::bigint, %s::bigint)",
+			i,
+			q.arg(item.ProductID),
+			q.arg(item.Quantity),
+			q.arg(item.UnitPrice.Amount),
+			q.arg(item.Discount.Amount),
+			q.arg(item.Total.Amount),
+		)
+	}
+
+	return `WITH input(ord, product_id, quantity, unit_price, discount, total) AS (
+	VALUES ` + strings.Join(rows, ", ") + `
+), ids AS (
+	SELECT ord, nextval(pg_get_serial_sequence('invoice_items', 'id')) AS id FROM input
+), inserted AS (
+	INSERT INTO invoice_items(id, invoice_header_id, product_id, quantity, unit_price, discount, total)
+	SELECT ids.id, ` + header + `::int, i.product_id, i.quantity, i.unit_price, i.discount, i.total
+	FROM input i JOIN ids ON ids.ord = i.ord
+	RETURNING id, created_at
+)
+SELECT ids.ord, inserted.id, inserted.created_at FROM inserted JOIN ids ON ids.id = inserted.id`, q.args
+}
@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		l, want int
+	}{
+		{-1, 50}, {0, 50}, {1, 1}, {500, 500}, {501, 500}, {1 << 30, 500},
+	}
+	for _, tt := range tests {
+		if got := limit(tt.l, 50, 500); got != tt.want {
+			t.Errorf("limit(%d) = %d, want %d", tt.l, got, tt.want)
+		}
+	}
+}
+
+func TestListInvoiceHeaders(t *testing.T) {
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.FixedZone("COT", -5*3600))
+	to := from.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name      string
+		ph        placeholder
+		ts        timestampCmp
+		f         invoiceheader.Filter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:     "default",
+			ph:       questionPlaceholder,
+			ts:       plainTimestampCmp,
+			wantArgs: []interface{}{invoiceheader.DefaultLimit, 0},
+		},
+		{
+			name:     "limit over the max",
+			ph:       questionPlaceholder,
+			ts:       plainTimestampCmp,
+			f:        invoiceheader.Filter{Limit: invoiceheader.MaxLimit + 1, Offset: 10},
+			wantArgs: []interface{}{invoiceheader.MaxLimit, 10},
+		},
+		{
+			name:      "postgres dates",
+			ph:        psqlPlaceholder,
+			ts:        psqlTimestampCmp,
+			f:         invoiceheader.Filter{Client: "Alexys", From: from, To: to},
+			wantWhere: " WHERE LOWER(client) LIKE $1 ESCAPE '!' AND created_at >= $2::timestamptz AND created_at < $3::timestamptz",
+			wantArgs:  []interface{}{"%alexys%", from.UTC(), to.UTC(), invoiceheader.DefaultLimit, 0},
+		},
+		{
+			name:      "sqlite dates",
+			ph:        questionPlaceholder,
+			ts:        sqliteTimestampCmp,
+			f:         invoiceheader.Filter{From: from, To: to},
+			wantWhere: " WHERE julianday(created_at) >= julianday(?) AND julianday(created_at) < julianday(?)",
+			wantArgs:  []interface{}{from.UTC(), to.UTC(), invoiceheader.DefaultLimit, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := listInvoiceHeaders(tt.ph, tt.ts, tt.f)
+
+			n := len(tt.wantArgs)
+			page := " ORDER BY created_at DESC, id DESC LIMIT " + tt.ph(n-1) + " OFFSET " + tt.ph(n)
+			if want := getAllInvoiceHeaders + tt.wantWhere + page; query != want {
+				t.Errorf("query =\n%s\nwant\n%s", query, want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestSQLiteListInvoices checks the filters by date of the invoices with
+// dates saved in other formats and time zones
+func TestSQLiteListInvoices(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	storage := NewSQLiteInvoice(db, NewSQLiteInvoiceHeader(db), NewSQLiteInvoiceItem(db))
+
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := []interface{}{
+		// the default of the column
+		"2022-02-28 23:59:59",
+		"2022-03-01 00:00:00",
+		// Go times, the last one is the 2022-03-02 05:00 UTC
+		day.Add(12 * time.Hour),
+		time.Date(2022, 3, 2, 0, 0, 0, 0, time.FixedZone("COT", -5*3600)),
+	}
+	for i, c := range createdAt {
+		m := &invoice.Model{
+			Header: &invoiceheader.Model{Client: "Alexys"},
+			Items:  invoiceitem.Models{{ProductID: 1, Quantity: uint(i + 1)}},
+		}
+		if err := storage.Create(ctx, m); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := db.Exec("UPDATE invoice_headers SET created_at = ? WHERE id = ?", c, m.Header.ID); err != nil {
+			t.Fatalf("UPDATE: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		f       invoiceheader.Filter
+		wantIDs []uint
+	}{
+		{name: "whole day", f: invoiceheader.Filter{From: day, To: day.AddDate(0, 0, 1)}, wantIDs: []uint{3, 2}},
+		{name: "from another zone", f: invoiceheader.Filter{From: day.Add(5 * time.Hour).In(time.FixedZone("COT", -5*3600))}, wantIDs: []uint{4, 3}},
+		{name: "page", f: invoiceheader.Filter{Limit: 2, Offset: 1}, wantIDs: []uint{3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := storage.List(ctx, tt.f)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+
+			ids := make([]uint, len(ms))
+			for i, m := range ms {
+				ids[i] = m.Header.ID
+				if len(m.Items) != 1 || m.Items[0].InvoiceHeaderID != m.Header.ID || m.Items[0].Quantity != m.Header.ID {
+					t.Errorf("invoice %d has the items %+v", m.Header.ID, m.Items)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	const getAll = "SELECT * FROM products"
+	createdAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		ph          placeholder
+		ts          timestampCmp
+		o           product.ListOptions
+		withDeleted bool
+		wantQuery   string
+		wantArgs    []interface{}
+	}{
+		{
+			name:      "default",
+			ph:        questionPlaceholder,
+			wantQuery: getAll + " WHERE deleted_at IS NULL ORDER BY id ASC LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{product.DefaultLimit, 0},
+		},
+		{
+			name:        "with deleted",
+			ph:          psqlPlaceholder,
+			withDeleted: true,
+			o:           product.ListOptions{Limit: 10, Offset: 20},
+			wantQuery:   getAll + " ORDER BY id ASC LIMIT $1 OFFSET $2",
+			wantArgs:    []interface{}{10, 20},
+		},
+		{
+			name:      "page over the max",
+			ph:        questionPlaceholder,
+			o:         product.ListOptions{Limit: product.MaxLimit + 1},
+			wantQuery: getAll + " WHERE deleted_at IS NULL ORDER BY id ASC LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{product.MaxLimit, 0},
+		},
+		{
+			name: "filters",
+			ph:   psqlPlaceholder,
+			o: product.ListOptions{
+				Name:     "50%_off",
+				MinPrice: &money.Money{Amount: 100, Currency: "USD"},
+				MaxPrice: &money.Money{Amount: 900, Currency: "USD"},
+			},
+			wantQuery: getAll + " WHERE deleted_at IS NULL AND LOWER(name) LIKE $1 ESCAPE '!'" +
+				" AND price_currency = $2 AND price_amount >= $3 AND price_currency = $4 AND price_amount <= $5" +
+				" ORDER BY id ASC LIMIT $6 OFFSET $7",
+			wantArgs: []interface{}{"%50!%!_off%", money.Currency("USD"), int64(100), money.Currency("USD"), int64(900), product.DefaultLimit, 0},
+		},
+		{
+			name:      "sort desc",
+			ph:        questionPlaceholder,
+			o:         product.ListOptions{Sort: product.SortPrice, Desc: true},
+			wantQuery: getAll + " WHERE deleted_at IS NULL ORDER BY price_amount DESC, id DESC LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{product.DefaultLimit, 0},
+		},
+		{
+			name:      "after id",
+			ph:        psqlPlaceholder,
+			o:         product.ListOptions{After: &product.Cursor{ID: 7}},
+			wantQuery: getAll + " WHERE deleted_at IS NULL AND id > $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
+			wantArgs:  []interface{}{uint(7), product.DefaultLimit, 0},
+		},
+		{
+			name: "after name",
+			ph:   psqlPlaceholder,
+			o:    product.ListOptions{Sort: product.SortName, After: &product.Cursor{ID: 7, Name: "lápiz"}},
+			wantQuery: getAll + " WHERE deleted_at IS NULL AND (name > $1 OR (name = $2 AND id > $3))" +
+				" ORDER BY name ASC, id ASC LIMIT $4 OFFSET $5",
+			wantArgs: []interface{}{"lápiz", "lápiz", uint(7), product.DefaultLimit, 0},
+		},
+		{
+			name: "after created_at desc",
+			ph:   questionPlaceholder,
+			o: product.ListOptions{
+				Sort:  product.SortCreatedAt,
+				Desc:  true,
+				After: &product.Cursor{ID: 7, CreatedAt: createdAt},
+			},
+			wantQuery: getAll + " WHERE deleted_at IS NULL AND (created_at < ? OR (created_at = ? AND id < ?))" +
+				" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{createdAt, createdAt, uint(7), product.DefaultLimit, 0},
+		},
+		{
+			name: "sqlite after created_at",
+			ph:   questionPlaceholder,
+			ts:   sqliteTimestampCmp,
+			o: product.ListOptions{
+				Sort:  product.SortCreatedAt,
+				After: &product.Cursor{ID: 7, CreatedAt: createdAt.In(time.FixedZone("COT", -5*3600))},
+			},
+			wantQuery: getAll + " WHERE deleted_at IS NULL AND (julianday(created_at) > julianday(?) OR (julianday(created_at) = julianday(?) AND id > ?))" +
+				" ORDER BY created_at ASC, id ASC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{createdAt, createdAt, uint(7), product.DefaultLimit, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := tt.ts
+			if ts == nil {
+				ts = plainTimestampCmp
+			}
+			query, args := listProducts(tt.ph, ts, getAll, tt.o, tt.withDeleted)
+			if query != tt.wantQuery {
+				t.Errorf("query =\n%s\nwant\n%s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestListProductsPages walks the pages of every sort on SQLite, every
+// product must be listed once and in order even with repeated values
+func TestListProductsPages(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "list.sqlite")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if err := s.Product().Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	const n = 7
+	createdAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		m := &product.Model{
+			Name:      fmt.Sprintf("producto %d", i%3),
+			Price:     money.New(int64(100*(i%2)), "USD"),
+			CreatedAt: createdAt.Add(time.Duration(i%4) * time.Hour),
+		}
+		if err := s.Product().Create(ctx, m); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	for _, sort := range []product.Sort{product.SortID, product.SortName, product.SortPrice, product.SortCreatedAt} {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc %v", sort, desc), func(t *testing.T) {
+				all, err := s.Product().List(ctx, product.ListOptions{Sort: sort, Desc: desc})
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if len(all) != n {
+					t.Fatalf("List returned %d products, want %d", len(all), n)
+				}
+
+				o := product.ListOptions{Sort: sort, Desc: desc, Limit: 2}
+				var paged product.Models
+				for page := 0; page <= n; page++ {
+					ms, err := s.Product().List(ctx, o)
+					if err != nil {
+						t.Fatalf("List page %d: %v", page, err)
+					}
+					paged = append(paged, ms...)
+					if o.After = o.Next(ms); o.After == nil {
+						break
+					}
+				}
+
+				if len(paged) != n {
+					t.Fatalf("the pages have %d products, want %d", len(paged), n)
+				}
+				for i := range all {
+					if paged[i].ID != all[i].ID {
+						t.Errorf("product %d of the pages is %d, want %d", i, paged[i].ID, all[i].ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	updatedAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	name, observations := "borrador", ""
+	price := money.New(500, "EUR")
+
+	tests := []struct {
+		name      string
+		p         product.Patch
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "name",
+			p:         product.Patch{Name: &name},
+			wantQuery: "UPDATE products SET name = $1, updated_at = $2, version = version + 1 WHERE id = $3 AND deleted_at IS NULL",
+			wantArgs:  []interface{}{name, updatedAt, uint(7)},
+		},
+		{
+			name: "every field with version",
+			p:    product.Patch{Name: &name, Observations: &observations, Price: &price, Version: 2},
+			wantQuery: "UPDATE products SET name = $1, observation = $2, price_amount = $3, price_currency = $4, updated_at = $5," +
+				" version = version + 1 WHERE id = $6 AND deleted_at IS NULL AND version = $7",
+			wantArgs: []interface{}{name, stringToNull(""), int64(500), money.Currency("EUR"), updatedAt, uint(7), uint(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := patchProduct(psqlPlaceholder, 7, tt.p, updatedAt)
+			if query != tt.wantQuery {
+				t.Errorf("query =\n%s\nwant\n%s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestInsertInvoiceItems checks that the items of more than one chunk keep
+// their order and that every row of the inserts has the arguments of its
+// item, in postgres next to its ordinal
+func TestInsertInvoiceItems(t *testing.T) {
+	ms := make(invoiceitem.Models, itemsPerInsert+1)
+	for i := range ms {
+		ms[i] = &invoiceitem.Model{
+			ProductID: uint(i + 1),
+			Quantity:  uint(i + 2),
+			UnitPrice: money.New(int64(i+3), "USD"),
+			Discount:  money.New(int64(i+4), "USD"),
+			Total:     money.New(int64(i+5), "USD"),
+		}
+	}
+
+	chunks := chunkItems(ms)
+	if len(chunks) != 2 || len(chunks[0]) != itemsPerInsert || len(chunks[1]) != 1 || chunks[1][0] != ms[itemsPerInsert] {
+		t.Fatalf("chunks of %d and %d items, want %d and 1", len(chunks[0]), len(chunks[len(chunks)-1]), itemsPerInsert)
+	}
+
+	for _, chunk := range chunks {
+		query, args := psqlInsertInvoiceItems(7, chunk)
+		if len(args) != 1+5*len(chunk) || args[0] != uint(7) {
+			t.Fatalf("psql args = %d, want %d starting by the header", len(args), 1+5*len(chunk))
+		}
+		for i, item := range chunk {
+			n := 2 + 5*i
+			row := fmt.Sprintf("(%d, $%d::int, $%d::int, $%d::bigint, $%d::bigint, $%d::bigint)", i, n, n+1, n+2, n+3, n+4)
+			if !strings.Contains(query, row) {
+				t.Fatalf("psql query has not the row %s", row)
+			}
+			want := []interface{}{item.ProductID, item.Quantity, item.UnitPrice.Amount, item.Discount.Amount, item.Total.Amount}
+			if got := args[n-1 : n+4]; !reflect.DeepEqual(got, want) {
+				t.Fatalf("psql args of the row %d = %v, want %v", i, got, want)
+			}
+		}
+
+		_, args = insertInvoiceItems(questionPlaceholder, 7, chunk)
+		for i, item := range chunk {
+			want := []interface{}{uint(7), item.ProductID, item.Quantity, item.UnitPrice.Amount, item.Discount.Amount, item.Total.Amount}
+			if got := args[6*i : 6*i+6]; !reflect.DeepEqual(got, want) {
+				t.Fatalf("mysql args of the row %d = %v, want %v", i, got, want)
+			}
+		}
+	}
+}
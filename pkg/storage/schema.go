@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/migrate"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"sort"
+	"strings"
+)
+
+// schema tables and columns that every driver must have after migrating
+var schema = map[string][]string{
+	"products": {
+		"id", "name", "observation", "price_amount", "price_currency",
+		"created_at", "updated_at", "deleted_at", "version",
+	},
+	"invoice_headers": {
+		"id", "client", "status", "kind", "reference_id", "currency",
+		"subtotal", "tax", "total", "created_at", "updated_at",
+	},
+	"invoice_items": {
+		"id", "invoice_header_id", "product_id", "quantity", "unit_price",
+		"discount", "total", "created_at", "updated_at",
+	},
+	"invoice_status_changes": {
+		"id", "invoice_header_id", "from_status", "to_status", "reason",
+		"created_at",
+	},
+}
+
+// lengths of the text columns that the models validate, they must match
+// the size of the column in the db
+var lengths = map[string]map[string]int64{
+	"products": {
+		"name":        product.NameMaxLength,
+		"observation": product.ObservationsMaxLength,
+	},
+}
+
+// getColumns queries to get the columns of a table and their max length,
+// NULL if they are not text
+var getColumns = map[Driver]string{
+	Postgres: `SELECT column_name, character_maximum_length FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = $1`,
+	MySQL: `SELECT column_name, character_maximum_length FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = ?`,
+	SQLite: `SELECT name, CASE WHEN type LIKE '%(%)' THEN CAST(substr(type, instr(type, '(') + 1,
+	instr(type, ')') - instr(type, '(') - 1) AS INTEGER) END FROM pragma_table_info(?)`,
+}
+
+// MigrationError is returned by the Migrate methods, it keeps the table
+// of the storage, the driver and the statement that failed
+type MigrationError struct {
+	Table     string
+	Driver    Driver
+	Statement string
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	if e.Statement == "" {
+		return fmt.Sprintf("migrate %s (%s): %v", e.Table, e.Driver, e.Err)
+	}
+
+	// the statement of a *migrate.Error is shown once
+	err := e.Err
+	var migErr *migrate.Error
+	if errors.As(err, &migErr) && migErr.Statement == e.Statement {
+		err = migErr.Err
+	}
+	return fmt.Sprintf("migrate %s (%s) %q: %v", e.Table, e.Driver, migrate.TrimStatement(e.Statement), err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaError lists the tables and columns (table.column) missing in the
+// db and the columns whose length does not match the models
+type SchemaError struct {
+	Driver     Driver
+	Missing    []string
+	Mismatched []string
+}
+
+func (e *SchemaError) Error() string {
+	problems := make([]string, 0, 2)
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Mismatched) > 0 {
+		problems = append(problems, "mismatched "+strings.Join(e.Mismatched, ", "))
+	}
+	return fmt.Sprintf("schema %s: %s", e.Driver, strings.Join(problems, "; "))
+}
+
+// migrateSchema applies every pending migration of the versioned schema
+// of the driver and verifies all the tables of the schema. The Migrate
+// methods of the storages are aliases of it: any of them migrates all the
+// tables, table is the one of the storage and only names the error
+func migrateSchema(ctx context.Context, db *sql.DB, d Driver, table string) error {
+	m, err := newMigrator(db, d)
+	if err != nil {
+		return &MigrationError{table, d, "", err}
+	}
+
+	if err := m.Up(ctx); err != nil {
+		e := &MigrationError{table, d, "", err}
+		var migErr *migrate.Error
+		if errors.As(err, &migErr) {
+			e.Statement = migErr.Statement
+		}
+		return e
+	}
+
+	if err := verifyTables(ctx, db, d, schemaTables()...); err != nil {
+		return &MigrationError{table, d, "", err}
+	}
+	return nil
+}
+
+// schemaTables returns the tables of the schema sorted by name
+func schemaTables() []string {
+	tables := make([]string, 0, len(schema))
+	for t := range schema {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// verifyTables checks that the tables exist with all the columns of the
+// schema and the lengths of the models, it returns a *SchemaError with
+// everything that is wrong
+func verifyTables(ctx context.Context, db *sql.DB, d Driver, tables ...string) error {
+	query, ok := getColumns[d]
+	if !ok {
+		return fmt.Errorf("driver not implemented: %q", d)
+	}
+
+	e := &SchemaError{Driver: d}
+	for _, table := range tables {
+		columns, err := tableColumns(ctx, db, query, table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			e.Missing = append(e.Missing, table)
+			continue
+		}
+		for _, c := range schema[table] {
+			if _, ok := columns[c]; !ok {
+				e.Missing = append(e.Missing, table+"."+c)
+			}
+		}
+		for c, want := range lengths[table] {
+			// unbounded columns (zero) can not truncate the values
+			if got := columns[c]; got != 0 && got != want {
+				e.Mismatched = append(e.Mismatched, fmt.Sprintf("%s.%s(%d != %d)", table, c, got, want))
+			}
+		}
+	}
+	sort.Strings(e.Mismatched)
+
+	if len(e.Missing) > 0 || len(e.Mismatched) > 0 {
+		return e
+	}
+	return nil
+}
+
+// tableColumns returns the max length of every column of the table, zero
+// if it is not text
+func tableColumns(ctx context.Context, db *sql.DB, query, table string) (map[string]int64, error) {
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]int64)
+	for rows.Next() {
+		var c string
+		length := sql.NullInt64{}
+		if err := rows.Scan(&c, &length); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(c)] = length.Int64
+	}
+	return columns, rows.Err()
+}
+
+// VerifySchema checks that every table and column expected by the
+// storages exists, use it after migrating. Memory stores always pass
+func (s *Store) VerifySchema(ctx context.Context) error {
+	if s.driver == Memory {
+		return nil
+	}
+	return verifyTables(ctx, s.db, s.driver, schemaTables()...)
+}
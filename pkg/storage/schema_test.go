@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/migrate"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSQLiteSchema applies the SQLite schema through the Migrate of every
+// storage and the migrator, and reverts and applies it again
+func TestSQLiteSchema(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		migrate func(*Store) error
+	}{
+		{
+			name: "migrator",
+			migrate: func(s *Store) error {
+				m, err := s.Migrator()
+				if err != nil {
+					return err
+				}
+				return m.Up(ctx)
+			},
+		},
+		{
+			name:    "product",
+			migrate: func(s *Store) error { return s.Product().Migrate(ctx) },
+		},
+		{
+			name: "every storage",
+			migrate: func(s *Store) error {
+				if err := s.Product().Migrate(ctx); err != nil {
+					return err
+				}
+				if err := s.InvoiceHeader().Migrate(ctx); err != nil {
+					return err
+				}
+				return s.InvoiceItem().Migrate(ctx)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "schema.sqlite")})
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer s.Close()
+
+			if err := tt.migrate(s); err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+
+			m, err := s.Migrator()
+			if err != nil {
+				t.Fatalf("Migrator: %v", err)
+			}
+			last := sqliteMigrations[len(sqliteMigrations)-1].Version
+			for _, step := range []struct {
+				name string
+				run  func() error
+				want uint
+			}{
+				{"up", func() error { return m.Up(ctx) }, last},
+				{"goto 0", func() error { return m.Goto(ctx, 0) }, 0},
+				{"up again", func() error { return m.Up(ctx) }, last},
+			} {
+				if err := step.run(); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				v, err := m.Version(ctx)
+				if err != nil {
+					t.Fatalf("Version: %v", err)
+				}
+				if v != step.want {
+					t.Errorf("%s: version = %d, want %d", step.name, v, step.want)
+				}
+			}
+
+			ss, err := m.Status(ctx)
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			for _, st := range ss {
+				if !st.Applied || st.Modified {
+					t.Errorf("migration %d: applied %v modified %v", st.Version, st.Applied, st.Modified)
+				}
+			}
+		})
+	}
+}
+
+// TestSQLiteMigrateVerifiesSchema checks that the Migrate of a storage
+// verifies every table of the schema, not only its own
+func TestSQLiteMigrateVerifiesSchema(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "schema.sqlite")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	// an old invoice_headers without client, CREATE TABLE IF NOT EXISTS
+	// keeps it
+	if _, err := s.DB().ExecContext(ctx, "CREATE TABLE invoice_headers(id INTEGER PRIMARY KEY, created_at TIMESTAMP, updated_at TIMESTAMP)"); err != nil {
+		t.Fatalf("create invoice_headers: %v", err)
+	}
+
+	err = s.Product().Migrate(ctx)
+	var migErr *MigrationError
+	if !errors.As(err, &migErr) || migErr.Table != "products" || migErr.Driver != SQLite {
+		t.Fatalf("err = %v, want a *MigrationError of products", err)
+	}
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || !reflect.DeepEqual(schemaErr.Missing, []string{"invoice_headers.client"}) {
+		t.Errorf("err = %v, want invoice_headers.client missing", err)
+	}
+
+	if err := s.VerifySchema(ctx); !errors.As(err, &schemaErr) {
+		t.Errorf("VerifySchema: err = %v, want a *SchemaError", err)
+	}
+}
+
+func TestMigrationError(t *testing.T) {
+	stmt := "CREATE TABLE products(\n\tid SERIAL NOT NULL,\n\tname VARCHAR(25) NOT NULL\n)"
+	cause := errors.New("syntax error")
+
+	tests := []struct {
+		name string
+		err  *MigrationError
+		want string
+	}{
+		{
+			name: "without statement",
+			err:  &MigrationError{"products", Postgres, "", cause},
+			want: "migrate products (POSTGRES): syntax error",
+		},
+		{
+			name: "statement",
+			err:  &MigrationError{"products", Postgres, stmt, cause},
+			want: `migrate products (POSTGRES) "CREATE TABLE products( id SERIAL NOT NULL, name VARCHAR(25) NOT NULL )": syntax error`,
+		},
+		{
+			name: "statement of a migration",
+			err:  &MigrationError{"products", Postgres, stmt, &migrate.Error{Version: 1, Name: "create_products", Direction: "up", Statement: stmt, Err: cause}},
+			want: `migrate products (POSTGRES) "CREATE TABLE products( id SERIAL NOT NULL, name VARCHAR(25) NOT NULL )": syntax error`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error = %q, want %q", got, tt.want)
+			}
+			if !errors.Is(tt.err, cause) {
+				t.Errorf("the error does not wrap its cause")
+			}
+			if strings.Count(tt.err.Error(), "CREATE TABLE") > 1 {
+				t.Errorf("the statement is shown twice: %q", tt.err.Error())
+			}
+		})
+	}
+}
+
+// TestSQLiteVerifySchemaLengths checks that the lengths of the product
+// validation are checked against the columns of the db
+func TestSQLiteVerifySchemaLengths(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "schema.sqlite")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	// a products with a longer name, CREATE TABLE IF NOT EXISTS keeps it
+	if _, err := s.DB().ExecContext(ctx, `CREATE TABLE products(
+		id INTEGER PRIMARY KEY,
+		name VARCHAR(30) NOT NULL,
+		observation VARCHAR(100),
+		price INT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP
+	)`); err != nil {
+		t.Fatalf("create products: %v", err)
+	}
+
+	err = s.Product().Migrate(ctx)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || len(schemaErr.Missing) > 0 || !reflect.DeepEqual(schemaErr.Mismatched, []string{"products.name(30 != 25)"}) {
+		t.Errorf("err = %v, want products.name mismatched", err)
+	}
+}
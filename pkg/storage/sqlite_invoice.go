@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+)
+
+// SQLiteInvoice is used to work with sqlite - invoice
+type SQLiteInvoice struct {
+	db            *sql.DB
+	storageHeader invoiceheader.Storage
+	storageItems  invoiceitem.Storage
+}
+
+// NewSQLiteInvoice returns a new pointer of SQLiteInvoice
+func NewSQLiteInvoice(db *sql.DB, h invoiceheader.Storage, i invoiceitem.Storage) *SQLiteInvoice {
+	return &SQLiteInvoice{db, h, i}
+}
+
+// Create implements interface invoice.Storage
+func (p *SQLiteInvoice) Create(ctx context.Context, m *invoice.Model) error {
+	return createInvoice(ctx, p.db, p.storageHeader, p.storageItems, m)
+}
+
+// GetByID implements interface invoice.Storage
+func (p *SQLiteInvoice) GetByID(ctx context.Context, id uint) (*invoice.Model, error) {
+	return getInvoice(ctx, p.storageHeader, p.storageItems, id)
+}
+
+// List implements interface invoice.Storage
+func (p *SQLiteInvoice) List(ctx context.Context, f invoiceheader.Filter) (invoice.Models, error) {
+	return listInvoices(ctx, p.storageHeader, p.storageItems, f)
+}
+
+// ChangeStatus implements interface invoice.Storage
+func (p *SQLiteInvoice) ChangeStatus(ctx context.Context, c *invoiceheader.StatusChange) error {
+	return changeInvoiceStatus(ctx, p.db, p.storageHeader, p.storageItems, c, nil)
+}
+
+// Cancel implements interface invoice.Storage
+func (p *SQLiteInvoice) Cancel(ctx context.Context, c *invoiceheader.StatusChange, creditNote *invoice.Model) error {
+	return changeInvoiceStatus(ctx, p.db, p.storageHeader, p.storageItems, c, creditNote)
+}
+
+// StatusHistory implements interface invoice.Storage
+func (p *SQLiteInvoice) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	return p.storageHeader.StatusHistory(ctx, id)
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+)
+
+const (
+	sqliteCreateInvoiceHeader = `INSERT INTO invoice_headers(client, status, kind, reference_id, currency, subtotal, tax, total)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at`
+	sqliteGetInvoiceHeaderByID      = getAllInvoiceHeaders + " WHERE id = ?"
+	sqliteUpdateInvoiceHeaderStatus = `UPDATE invoice_headers SET status = ?, updated_at = ?
+	WHERE id = ? AND status = ?`
+	sqliteCreateInvoiceStatusChange = `INSERT INTO invoice_status_changes(invoice_header_id, from_status, to_status, reason, created_at)
+	VALUES (?, ?, ?, ?, ?) RETURNING id`
+	sqliteGetInvoiceStatusChanges = getAllInvoiceStatusChanges + " WHERE invoice_header_id = ? ORDER BY id"
+)
+
+// SQLiteInvoiceHeader used to work with sqlite - invoice_headers
+type SQLiteInvoiceHeader struct {
+	db    *sql.DB
+	stmts *stmtCache
+}
+
+// NewSQLiteInvoiceHeader returns a new pointer of SQLiteInvoiceHeader, it
+// prepares a statement per call. The storages of a Store reuse them
+func NewSQLiteInvoiceHeader(db *sql.DB) *SQLiteInvoiceHeader {
+	return &SQLiteInvoiceHeader{db, uncachedStmts(db)}
+}
+
+// Migrate implements interface invoiceHeader.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *SQLiteInvoiceHeader) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, SQLite, "invoice_headers")
+}
+
+// CreateTx implements interface invoiceHeader.storage
+func (p *SQLiteInvoiceHeader) CreateTx(ctx context.Context, tx *sql.Tx, m *invoiceheader.Model) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, sqliteCreateInvoiceHeader)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		m.Client,
+		m.Status,
+		m.Kind,
+		uintToNull(m.ReferenceID),
+		m.Currency,
+		m.Subtotal.Amount,
+		m.Tax.Amount,
+		m.Total.Amount,
+	).Scan(&m.ID, &m.CreateAt)
+}
+
+// GetByID implements interface invoiceHeader.storage
+func (p *SQLiteInvoiceHeader) GetByID(ctx context.Context, id uint) (*invoiceheader.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, sqliteGetInvoiceHeaderByID)
+	if err != nil {
+		return &invoiceheader.Model{}, err
+	}
+	defer p.stmts.release(stmt)
+
+	return scanRowInvoiceHeader(stmt.QueryRowContext(ctx, id))
+}
+
+// List implements interface invoiceHeader.storage
+func (p *SQLiteInvoiceHeader) List(ctx context.Context, f invoiceheader.Filter) (invoiceheader.Models, error) {
+	query, args := listInvoiceHeaders(questionPlaceholder, sqliteTimestampCmp, f)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(invoiceheader.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceHeader(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// ChangeStatusTx implements interface invoiceHeader.storage, the update
+// only matches while the invoice keeps the status c.From
+func (p *SQLiteInvoiceHeader) ChangeStatusTx(ctx context.Context, tx *sql.Tx, c *invoiceheader.StatusChange) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, sqliteUpdateInvoiceHeaderStatus)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, c.To, c.CreatedAt, c.InvoiceHeaderID, c.From)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return invoiceheader.ErrStatusChanged
+	}
+
+	stmt, err = p.stmts.prepareTx(ctx, tx, sqliteCreateInvoiceStatusChange)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		c.InvoiceHeaderID,
+		c.From,
+		c.To,
+		stringToNull(c.Reason),
+		c.CreatedAt,
+	).Scan(&c.ID)
+}
+
+// StatusHistory implements interface invoiceHeader.storage
+func (p *SQLiteInvoiceHeader) StatusHistory(ctx context.Context, id uint) (invoiceheader.StatusChanges, error) {
+	rows, err := p.db.QueryContext(ctx, sqliteGetInvoiceStatusChanges, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cs := make(invoiceheader.StatusChanges, 0)
+	for rows.Next() {
+		c, err := scanRowStatusChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	sqliteCreateInvoiceItem = `INSERT INTO invoice_items(invoice_header_id, product_id, quantity, unit_price, discount, total)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id, created_at`
+	sqliteGetInvoiceItemsByHeaderID = getInvoiceItems + " WHERE i.invoice_header_id = ? ORDER BY i.id"
+	sqliteProductExists             = `SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)`
+)
+
+// SQLiteInvoiceItem used to work with sqlite - invoice_items
+type SQLiteInvoiceItem struct {
+	db    *sql.DB
+	stmts *stmtCache
+}
+
+// NewSQLiteInvoiceItem returns a new pointer of SQLiteInvoiceItem, it
+// prepares a statement per call. The storages of a Store reuse them
+func NewSQLiteInvoiceItem(db *sql.DB) *SQLiteInvoiceItem {
+	return &SQLiteInvoiceItem{db, uncachedStmts(db)}
+}
+
+// Migrate implements interface invoiceItem.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *SQLiteInvoiceItem) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, SQLite, "invoice_items")
+}
+
+// CreateTx implements interface invoiceItem.storage, a missing product is a
+// *product.Error of kind ErrForeignKey
+func (p *SQLiteInvoiceItem) CreateTx(ctx context.Context, tx *sql.Tx, headerID uint, ms invoiceitem.Models) error {
+	stmt, err := p.stmts.prepareTx(ctx, tx, sqliteCreateInvoiceItem)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range ms {
+		err = stmt.QueryRowContext(
+			ctx,
+			headerID,
+			item.ProductID,
+			item.Quantity,
+			item.UnitPrice.Amount,
+			item.Discount.Amount,
+			item.Total.Amount,
+		).Scan(&item.ID, &item.CreatedAt)
+		if err != nil {
+			return sqliteItemError(ctx, tx, item.ProductID, err)
+		}
+	}
+	return nil
+}
+
+// GetByHeaderID implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *SQLiteInvoiceItem) GetByHeaderID(ctx context.Context, headerID uint) (invoiceitem.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, sqliteGetInvoiceItemsByHeaderID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	rows, err := stmt.QueryContext(ctx, headerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(invoiceitem.Models, 0)
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// GetByHeaderIDs implements interface invoiceItem.storage, the items have
+// the name of their product
+func (p *SQLiteInvoiceItem) GetByHeaderIDs(ctx context.Context, headerIDs []uint) (invoiceitem.Models, error) {
+	ms := make(invoiceitem.Models, 0)
+	if len(headerIDs) == 0 {
+		return ms, nil
+	}
+
+	query, args := invoiceItemsByHeaderIDs(questionPlaceholder, headerIDs)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// sqliteItemError is itemProductError for SQLite, which does not name the
+// foreign key that failed: the violation is of itemProductFK only when the
+// product does not exist in tx
+func sqliteItemError(ctx context.Context, tx *sql.Tx, productID uint, err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+		return err
+	}
+
+	var exists bool
+	if tx.QueryRowContext(ctx, sqliteProductExists, productID).Scan(&exists) != nil || exists {
+		return err
+	}
+	return &product.Error{ID: productID, Kind: product.ErrForeignKey, Err: err}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import "github.com/eltaljohn/go-db/pkg/migrate"
+
+// sqliteMigrations versioned schema of sqlite, a released migration must
+// not change, add a new one instead
+var sqliteMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "create_products",
+		Up: []string{`CREATE TABLE IF NOT EXISTS products(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	name VARCHAR(25) NOT NULL,
+	observation VARCHAR(100),
+	price INT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP
+)`},
+		Down: []string{`DROP TABLE products`},
+	},
+	{
+		Version: 2,
+		Name:    "create_invoice_headers",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_headers(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	client VARCHAR(25) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP
+)`},
+		Down: []string{`DROP TABLE invoice_headers`},
+	},
+	{
+		Version: 3,
+		Name:    "create_invoice_items",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_items(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	invoice_header_id INT NOT NULL,
+	product_id INT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP,
+	CONSTRAINT invoice_items_invoice_header_id_fk FOREIGN KEY (invoice_header_id)
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT,
+	CONSTRAINT invoice_items_product_id_fk FOREIGN KEY (product_id)
+	REFERENCES products (id) ON UPDATE RESTRICT ON DELETE RESTRICT
+)`},
+		Down: []string{`DROP TABLE invoice_items`},
+	},
+	{
+		Version: 4,
+		Name:    "add_invoice_items_amounts",
+		Up: []string{
+			`ALTER TABLE invoice_items ADD COLUMN quantity INT NOT NULL DEFAULT 1`,
+			`ALTER TABLE invoice_items ADD COLUMN unit_price INT NOT NULL DEFAULT 0`,
+			`ALTER TABLE invoice_items ADD COLUMN discount INT NOT NULL DEFAULT 0`,
+			`ALTER TABLE invoice_items ADD COLUMN total INT NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE invoice_items DROP COLUMN quantity`,
+			`ALTER TABLE invoice_items DROP COLUMN unit_price`,
+			`ALTER TABLE invoice_items DROP COLUMN discount`,
+			`ALTER TABLE invoice_items DROP COLUMN total`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_invoice_headers_totals",
+		Up: []string{
+			`ALTER TABLE invoice_headers ADD COLUMN subtotal INT NOT NULL DEFAULT 0`,
+			`ALTER TABLE invoice_headers ADD COLUMN tax INT NOT NULL DEFAULT 0`,
+			`ALTER TABLE invoice_headers ADD COLUMN total INT NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE invoice_headers DROP COLUMN subtotal`,
+			`ALTER TABLE invoice_headers DROP COLUMN tax`,
+			`ALTER TABLE invoice_headers DROP COLUMN total`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_invoice_headers_status",
+		Up: []string{
+			`ALTER TABLE invoice_headers ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'issued'`,
+			`ALTER TABLE invoice_headers ADD COLUMN kind VARCHAR(12) NOT NULL DEFAULT 'invoice'`,
+			`ALTER TABLE invoice_headers ADD COLUMN reference_id INT
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT`,
+		},
+		Down: []string{
+			`ALTER TABLE invoice_headers DROP COLUMN status`,
+			`ALTER TABLE invoice_headers DROP COLUMN kind`,
+			`ALTER TABLE invoice_headers DROP COLUMN reference_id`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_invoice_status_changes",
+		Up: []string{`CREATE TABLE IF NOT EXISTS invoice_status_changes(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	invoice_header_id INT NOT NULL,
+	from_status VARCHAR(10) NOT NULL,
+	to_status VARCHAR(10) NOT NULL,
+	reason VARCHAR(255),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT invoice_status_changes_invoice_header_id_fk FOREIGN KEY (invoice_header_id)
+	REFERENCES invoice_headers (id) ON UPDATE RESTRICT ON DELETE RESTRICT
+)`},
+		Down: []string{`DROP TABLE invoice_status_changes`},
+	},
+	{
+		Version: 8,
+		Name:    "products_price_money",
+		Up: []string{
+			`ALTER TABLE products ADD COLUMN price_amount BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE products ADD COLUMN price_currency CHAR(3) NOT NULL DEFAULT 'USD'`,
+			`UPDATE products SET price_amount = price * 100`,
+			`ALTER TABLE products DROP COLUMN price`,
+		},
+		Down: []string{
+			`ALTER TABLE products ADD COLUMN price INT NOT NULL DEFAULT 0`,
+			`UPDATE products SET price = price_amount / 100`,
+			`ALTER TABLE products DROP COLUMN price_amount`,
+			`ALTER TABLE products DROP COLUMN price_currency`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "invoices_money",
+		Up: []string{
+			`ALTER TABLE invoice_headers ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD'`,
+			`UPDATE invoice_headers SET subtotal = subtotal * 100, tax = tax * 100, total = total * 100`,
+			`UPDATE invoice_items SET unit_price = unit_price * 100, discount = discount * 100, total = total * 100`,
+		},
+		Down: []string{
+			`UPDATE invoice_items SET unit_price = unit_price / 100, discount = discount / 100, total = total / 100`,
+			`UPDATE invoice_headers SET subtotal = subtotal / 100, tax = tax / 100, total = total / 100`,
+			`ALTER TABLE invoice_headers DROP COLUMN currency`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_products_deleted_at",
+		Up:      []string{`ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP`},
+		Down:    []string{`ALTER TABLE products DROP COLUMN deleted_at`},
+	},
+	{
+		Version: 11,
+		Name:    "add_products_version",
+		Up:      []string{`ALTER TABLE products ADD COLUMN version INT NOT NULL DEFAULT 1`},
+		Down:    []string{`ALTER TABLE products DROP COLUMN version`},
+	},
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"time"
+)
+
+const (
+	sqliteCreateProduct = `INSERT INTO products(name, observation, price_amount, price_currency, created_at)
+	VALUES (?, ?, ?, ?, ?) RETURNING id, version`
+	sqliteGetAllProduct = `SELECT id, name, observation, price_amount, price_currency, created_at, updated_at, deleted_at,
+	version FROM products`
+	sqliteGetProductByID = sqliteGetAllProduct + " WHERE id = ?"
+	sqliteUpdateProduct  = `UPDATE products SET name = ?, observation = ?, price_amount = ?, price_currency = ?, updated_at = ?,
+	version = version + 1 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`
+	sqliteDeleteProduct  = "UPDATE products SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL"
+	sqliteRestoreProduct = "UPDATE products SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL"
+)
+
+// sqliteProduct used to work with sqlite - product
+type sqliteProduct struct {
+	db    *sql.DB
+	stmts *stmtCache
+}
+
+// newSQLiteProduct returns a new pointer of sqliteProduct
+func newSQLiteProduct(db *sql.DB, stmts *stmtCache) *sqliteProduct {
+	return &sqliteProduct{db, stmts}
+}
+
+// Migrate implements interface product.storage, it is an alias of
+// migrateSchema: the whole versioned schema is migrated, not only the table
+func (p *sqliteProduct) Migrate(ctx context.Context) error {
+	return migrateSchema(ctx, p.db, SQLite, "products")
+}
+
+// Create implements interface product.storage
+func (p *sqliteProduct) Create(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, sqliteCreateProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	err = stmt.QueryRowContext(
+		ctx,
+		m.Name,
+		stringToNull(m.Observations),
+		m.Price.Amount,
+		m.Price.Currency,
+		m.CreatedAt,
+	).Scan(&m.ID, &m.Version)
+	if err != nil {
+		return productError(0, err)
+	}
+
+	return nil
+}
+
+// GetAll implements interface product.storage
+func (p *sqliteProduct) GetAll(ctx context.Context) (product.Models, error) {
+	stmt, err := p.stmts.prepare(ctx, sqliteGetAllProduct+notDeleted(ctx, " WHERE "))
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(product.Models, 0)
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// List implements interface product.storage
+func (p *sqliteProduct) List(ctx context.Context, o product.ListOptions) (product.Models, error) {
+	query, args := listProducts(questionPlaceholder, sqliteTimestampCmp, sqliteGetAllProduct, o, product.IncludeDeleted(ctx))
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make(product.Models, 0)
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// Each implements interface product.storage, the rows are scanned as
+// they arrive
+func (p *sqliteProduct) Each(ctx context.Context, fn func(*product.Model) error) error {
+	rows, err := p.db.QueryContext(ctx, sqliteGetAllProduct+notDeleted(ctx, " WHERE ")+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRowProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetByID implements interface product.storage
+func (p *sqliteProduct) GetByID(ctx context.Context, id uint) (*product.Model, error) {
+	stmt, err := p.stmts.prepare(ctx, sqliteGetProductByID+notDeleted(ctx, " AND "))
+	if err != nil {
+		return nil, err
+	}
+	defer p.stmts.release(stmt)
+
+	m, err := scanRowProduct(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, productError(id, err)
+	}
+
+	return m, nil
+}
+
+// Update implements interface product.storage
+func (p *sqliteProduct) Update(ctx context.Context, m *product.Model) error {
+	stmt, err := p.stmts.prepare(ctx, sqliteUpdateProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(
+		ctx,
+		m.Name,
+		stringToNull(m.Observations),
+		m.Price.Amount,
+		m.Price.Currency,
+		timeToNull(m.UpdatedAt),
+		m.ID,
+		m.Version,
+		m.Version,
+	)
+	if err != nil {
+		return productError(m.ID, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return productUpdateError(ctx, p, m)
+	}
+	if m.Version != 0 {
+		m.Version++
+	}
+
+	return nil
+}
+
+// Patch implements interface product.storage
+func (p *sqliteProduct) Patch(ctx context.Context, id uint, patch product.Patch) error {
+	if patch.Empty() {
+		return product.ErrEmptyPatch
+	}
+
+	query, args := patchProduct(questionPlaceholder, id, patch, time.Now())
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return productError(id, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return productUpdateError(ctx, p, &product.Model{ID: id, Version: patch.Version})
+	}
+
+	return nil
+}
+
+// Delete implements interface product.storage, it sets deleted_at
+func (p *sqliteProduct) Delete(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, sqliteDeleteProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return productNotFound(id)
+	}
+
+	return nil
+}
+
+// Restore implements interface product.storage
+func (p *sqliteProduct) Restore(ctx context.Context, id uint) error {
+	stmt, err := p.stmts.prepare(ctx, sqliteRestoreProduct)
+	if err != nil {
+		return err
+	}
+	defer p.stmts.release(stmt)
+
+	res, err := stmt.ExecContext(ctx, time.Now(), id)
+	if err != nil {
+		return productError(id, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return productNotFound(id)
+	}
+
+	return nil
+}
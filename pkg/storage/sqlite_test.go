@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"path/filepath"
+	"testing"
+)
+
+// sqliteDB opens a migrated SQLite db in a temp file with the product 1
+func sqliteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", sqliteDSN(filepath.Join(t.TempDir(), "go-db.sqlite")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, s := range []interface{ Migrate(context.Context) error }{
+		newSQLiteProduct(db, uncachedStmts(db)), NewSQLiteInvoiceHeader(db), NewSQLiteInvoiceItem(db),
+	} {
+		if err := s.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+	}
+
+	if err := newSQLiteProduct(db, uncachedStmts(db)).Create(context.Background(), &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return db
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	for _, name := range []string{"go-db.sqlite", "a?b.sqlite", "a#b.sqlite", "50%.sqlite", "con espacio.sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			db, err := sql.Open("sqlite", sqliteDSN(path))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+
+			var file string
+			if err := db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file); err != nil {
+				t.Fatalf("database_list: %v", err)
+			}
+			if file != path {
+				t.Errorf("file = %q, want %q", file, path)
+			}
+
+			var fk int
+			if err := db.QueryRow("PRAGMA foreign_keys").Scan(&fk); err != nil || fk != 1 {
+				t.Errorf("foreign_keys = %d, %v, want 1", fk, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(product.Storage) error
+		wantErr bool
+		// wantName is the name of the product 1 after run, empty if it
+		// was deleted
+		wantName string
+	}{
+		{
+			name: "update",
+			run: func(ps product.Storage) error {
+				return ps.Update(context.Background(), &product.Model{ID: 1, Name: "borrador", Price: money.New(500, "USD")})
+			},
+			wantName: "borrador",
+		},
+		{
+			name: "update missing",
+			run: func(ps product.Storage) error {
+				return ps.Update(context.Background(), &product.Model{ID: 9, Name: "borrador"})
+			},
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+		{
+			name: "delete",
+			run:  func(ps product.Storage) error { return ps.Delete(context.Background(), 1) },
+		},
+		{
+			name:     "delete missing",
+			run:      func(ps product.Storage) error { return ps.Delete(context.Background(), 9) },
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+		{
+			name: "delete twice",
+			run: func(ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Delete(context.Background(), 1)
+			},
+			wantErr: true,
+		},
+		{
+			name: "update deleted",
+			run: func(ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Update(context.Background(), &product.Model{ID: 1, Name: "borrador", Price: money.New(500, "USD")})
+			},
+			wantErr: true,
+		},
+		{
+			name: "restore",
+			run: func(ps product.Storage) error {
+				if err := ps.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+				return ps.Restore(context.Background(), 1)
+			},
+			wantName: "lápiz",
+		},
+		{
+			name:     "restore active",
+			run:      func(ps product.Storage) error { return ps.Restore(context.Background(), 1) },
+			wantErr:  true,
+			wantName: "lápiz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqliteDB(t)
+			ps := newSQLiteProduct(db, uncachedStmts(db))
+
+			if err := tt.run(ps); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			m, err := ps.GetByID(context.Background(), 1)
+			if tt.wantName == "" {
+				if !errors.Is(err, product.ErrNotFound) {
+					t.Errorf("GetByID: err = %v, want %v", err, product.ErrNotFound)
+				}
+				withDeleted := product.WithDeleted(context.Background())
+				if m, err := ps.GetByID(withDeleted, 1); err != nil || !m.Deleted() {
+					t.Errorf("GetByID with deleted = %v, %v, want the deleted product", m, err)
+				}
+				if ms, err := ps.GetAll(withDeleted); err != nil || len(ms) != 1 {
+					t.Errorf("GetAll with deleted = %v, %v, want the product 1", ms, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if m.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", m.Name, tt.wantName)
+			}
+
+			ms, err := ps.GetAll(context.Background())
+			if err != nil || len(ms) != 1 {
+				t.Errorf("GetAll = %v, %v, want the product 1", ms, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteInvoiceCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   invoiceitem.Models
+		wantErr bool
+	}{
+		{name: "ok", items: invoiceitem.Models{{ProductID: 1}, {ProductID: 1}}},
+		{name: "without items"},
+		{name: "missing product rolls back", items: invoiceitem.Models{{ProductID: 1}, {ProductID: 9}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqliteDB(t)
+			storage := NewSQLiteInvoice(db, NewSQLiteInvoiceHeader(db), NewSQLiteInvoiceItem(db))
+			m := &invoice.Model{Header: &invoiceheader.Model{Client: "Alexys"}, Items: tt.items}
+
+			if err := storage.Create(context.Background(), m); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			var headers, items int
+			if err := db.QueryRow("SELECT count(*), (SELECT count(*) FROM invoice_items) FROM invoice_headers").Scan(&headers, &items); err != nil {
+				t.Fatalf("count: %v", err)
+			}
+			if tt.wantErr {
+				if headers != 0 || items != 0 {
+					t.Errorf("the failed create left %d headers and %d items", headers, items)
+				}
+				return
+			}
+			if headers != 1 || items != len(tt.items) {
+				t.Errorf("db has %d headers and %d items, want 1 and %d", headers, items, len(tt.items))
+			}
+			for _, item := range m.Items {
+				var headerID uint
+				if err := db.QueryRow("SELECT invoice_header_id FROM invoice_items WHERE id = ?", item.ID).Scan(&headerID); err != nil || headerID != m.Header.ID {
+					t.Errorf("item %d: header %d, %v, want %d", item.ID, headerID, err, m.Header.ID)
+				}
+			}
+		})
+	}
+}
+
+// TestSQLiteMigrateSchema checks that the Migrate of one storage creates
+// every table of the schema
+func TestSQLiteMigrateSchema(t *testing.T) {
+	db, err := sql.Open("sqlite", sqliteDSN(filepath.Join(t.TempDir(), "go-db.sqlite")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if err := NewSQLiteInvoiceItem(db).Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	for _, table := range []string{"products", "invoice_headers", "invoice_items", "schema_migrations"} {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil || n != 1 {
+			t.Errorf("table %s: %d, %v, want it created", table, n, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// stmtCache prepares every query once and reuses the statement in the next
+// calls. The Store shares its cache with its storages and closes it with
+// the connection. The storages built without a Store use an uncached one,
+// nothing would close their statements
+type stmtCache struct {
+	db     *sql.DB
+	cached bool
+
+	mu     sync.RWMutex
+	stmts  map[string]*sql.Stmt
+	closed bool
+}
+
+// newStmtCache returns a new pointer of stmtCache
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, cached: true, stmts: make(map[string]*sql.Stmt)}
+}
+
+// uncachedStmts returns a stmtCache that prepares a statement per call,
+// release closes it
+func uncachedStmts(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db}
+}
+
+// prepare returns the statement of query, it must be passed to release
+// when it is not used anymore. The cache is not locked while the statement
+// is prepared, if two calls prepare the same query the second statement is
+// closed
+func (c *stmtCache) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if !c.cached {
+		return c.db.PrepareContext(ctx, query)
+	}
+
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return nil, sql.ErrConnDone
+	}
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		stmt.Close()
+		return nil, sql.ErrConnDone
+	}
+	if prepared, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return prepared, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// release closes stmt if it is not cached
+func (c *stmtCache) release(stmt *sql.Stmt) {
+	if !c.cached {
+		stmt.Close()
+	}
+}
+
+// prepareTx returns the statement of query bound to tx, closing it does
+// not close the statement of the cache
+func (c *stmtCache) prepareTx(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	if !c.cached {
+		return tx.PrepareContext(ctx, query)
+	}
+
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return tx.StmtContext(ctx, stmt), nil
+}
+
+// Close closes the statements, prepare fails after it
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var first error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(c.stmts, query)
+	}
+	c.closed = true
+	return first
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// benchConfigs returns SQLite in a temp file and the Postgres and MySQL
+// of the environment (POSTGRES_DSN_DB, MYSQL_DSN_DB...) when they are set
+func benchConfigs(b *testing.B) map[string]Config {
+	cs := map[string]Config{
+		"sqlite": {Driver: SQLite, Path: filepath.Join(b.TempDir(), "bench.sqlite")},
+	}
+	for name, d := range map[string]Driver{"postgres": Postgres, "mysql": MySQL} {
+		if c, err := ConfigFromEnv(d); err == nil {
+			cs[name] = c
+		}
+	}
+	return cs
+}
+
+// benchStore opens a migrated store of c with a product
+func benchStore(b *testing.B, c Config) (*Store, *product.Model) {
+	b.Helper()
+	ctx := context.Background()
+
+	s, err := Open(c)
+	if err != nil {
+		b.Fatalf("Open: %v", err)
+	}
+	b.Cleanup(func() { s.Close() })
+
+	m, err := s.Migrator()
+	if err != nil {
+		b.Fatalf("Migrator: %v", err)
+	}
+	if err := m.Up(ctx); err != nil {
+		b.Fatalf("Up: %v", err)
+	}
+
+	p := &product.Model{Name: "bench", Price: money.New(100, "USD")}
+	if err := s.product().Create(ctx, p); err != nil {
+		b.Fatalf("Create: %v", err)
+	}
+	return s, p
+}
+
+// BenchmarkProductGetByID compares preparing the statement in every call,
+// as the storages did before the cache, with the cache of the Store
+func BenchmarkProductGetByID(b *testing.B) {
+	for name, c := range benchConfigs(b) {
+		s, p := benchStore(b, c)
+		stmts := map[string]*stmtCache{
+			"prepare_per_call": uncachedStmts(s.db),
+			"cached":           s.stmts,
+		}
+		for mode, cache := range stmts {
+			b.Run(name+"/"+mode, func(b *testing.B) {
+				st := &Store{driver: s.driver, db: s.db, stmts: cache}
+				storage := st.product()
+				ctx := context.Background()
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := storage.GetByID(ctx, p.ID); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStmtCachePrepare(t *testing.T) {
+	s, err := Open(Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "stmt.sqlite")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	c := newStmtCache(s.db)
+
+	const query = "SELECT 1"
+	var wg sync.WaitGroup
+	stmts := make([]interface{}, 8)
+	for i := range stmts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stmt, err := c.prepare(ctx, query)
+			if err != nil {
+				t.Errorf("prepare: %v", err)
+				return
+			}
+			stmts[i] = stmt
+		}(i)
+	}
+	wg.Wait()
+
+	for i, stmt := range stmts {
+		if stmt != stmts[0] {
+			t.Errorf("prepare %d returned another statement", i)
+		}
+	}
+	if len(c.stmts) != 1 {
+		t.Errorf("cache has %d statements, want 1", len(c.stmts))
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c.prepare(ctx, query); err == nil {
+		t.Error("prepare after Close did not fail")
+	}
+}
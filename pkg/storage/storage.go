@@ -1,20 +1,27 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
 	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/trace"
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
-	"log"
+	_ "modernc.org/sqlite"
 	"sync"
 	"time"
 )
 
 var (
-	db   *sql.DB
-	once sync.Once
+	mu sync.Mutex
+	// stores opened by New, one per driver
+	stores = make(map[Driver]*Store)
+	// pool is the last store opened by New
+	pool *Store
 )
 
 // Driver of storage
@@ -24,73 +31,70 @@ type Driver string
 const (
 	MySQL    Driver = "MYSQL"
 	Postgres Driver = "POSTGRES"
+	SQLite   Driver = "SQLITE"
+	Memory   Driver = "MEMORY"
 )
 
-// New creates the connection with DB
-func New(d Driver) {
-	envMap, err := godotenv.Read()
+// New creates the connection with DB reading the environment and the
+// optional .env file, a driver is connected only once per process.
+//
+// Deprecated: use Open, it returns a Store that owns its connection
+func New(d Driver) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if s, ok := stores[d]; ok {
+		pool = s
+		return nil
+	}
+
+	if err := LoadEnvFile(); err != nil {
+		return err
+	}
+	c, err := ConfigFromEnv(d)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return err
 	}
-	switch d {
-	case MySQL:
-		newMySQLDB(envMap)
-	case Postgres:
-		newPostgresDB(envMap)
+
+	s, err := Open(c)
+	if err != nil {
+		return err
 	}
-}
+	stores[d] = s
+	pool = s
 
-func newPostgresDB(env map[string]string) {
-	once.Do(func() {
-		var err error
-		dsn := fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-			env["POSTGRES_USER_DB"],
-			env["POSTGRES_PASSWORD_DB"],
-			env["POSTGRES_DOMAIN_DB"],
-			env["POSTGRES_PORT_DB"],
-			env["POSTGRES_ENGINE_DB"],
-		)
-		db, err = sql.Open("postgres", dsn)
-		if err != nil {
-			log.Fatalf("Can't open db: %v", err)
-		}
+	return nil
+}
 
-		if err := db.Ping(); err != nil {
-			log.Fatalf("Can't do ping db: %v", err)
-		}
+// Pool return the connection of the last driver opened with New
+//
+// Deprecated: use Store.DB
+func Pool() *sql.DB {
+	mu.Lock()
+	defer mu.Unlock()
 
-		fmt.Println("Connected to PostgreSQL")
-	})
+	if pool == nil {
+		return nil
+	}
+	return pool.db
 }
 
-func newMySQLDB(env map[string]string) {
-	once.Do(func() {
-		var err error
-		dsn := fmt.Sprintf(
-			"%s:%s@tcp(%s:%s)/%s?tls=false&autocommit=true&allowNativePasswords=true&parseTime=true",
-			env["MYSQL_USER_DB"],
-			env["MYSQL_PASSWORD_DB"],
-			env["MYSQL_DOMAIN_DB"],
-			env["MYSQL_PORT_DB"],
-			env["MYSQL_ENGINE_DB"],
-		)
-		db, err = sql.Open("mysql", dsn)
-		if err != nil {
-			log.Fatalf("Can't open db: %v", err)
-		}
-
-		if err := db.Ping(); err != nil {
-			log.Fatalf("Can't do ping db: %v", err)
-		}
+// opened returns the store opened by New for the driver
+func opened(driver Driver) (*Store, error) {
+	switch driver {
+	case Postgres, MySQL, SQLite, Memory:
+	default:
+		return nil, fmt.Errorf("driver not implemented")
+	}
 
-		fmt.Println("Connected to MySQL")
-	})
-}
+	mu.Lock()
+	defer mu.Unlock()
 
-// Pool return a unique intance of db
-func Pool() *sql.DB {
-	return db
+	s, ok := stores[driver]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not connected, call storage.New", driver)
+	}
+	return s, nil
 }
 
 func stringToNull(s string) sql.NullString {
@@ -109,6 +113,38 @@ func timeToNull(t time.Time) sql.NullTime {
 	return null
 }
 
+func uintToNull(u uint) sql.NullInt64 {
+	null := sql.NullInt64{Int64: int64(u)}
+	if null.Int64 != 0 {
+		null.Valid = true
+	}
+	return null
+}
+
+// notDeleted returns the condition that hides the deleted products, joined
+// to a query of products with op (" WHERE " or " AND "). It is empty when
+// ctx comes from product.WithDeleted
+func notDeleted(ctx context.Context, op string) string {
+	if product.IncludeDeleted(ctx) {
+		return ""
+	}
+	return op + "deleted_at IS NULL"
+}
+
+// productUpdateError returns the error of an update of m that matched no
+// row: ErrNotFound if the product does not exist or is deleted and
+// ErrStaleVersion if its version changed
+func productUpdateError(ctx context.Context, s product.Storage, m *product.Model) error {
+	stored, err := s.GetByID(product.WithDeleted(ctx), m.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Deleted() {
+		return productNotFound(m.ID)
+	}
+	return &product.Error{ID: m.ID, Kind: product.ErrStaleVersion}
+}
+
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
@@ -117,14 +153,18 @@ func scanRowProduct(s scanner) (*product.Model, error) {
 	m := &product.Model{}
 	observationNull := sql.NullString{}
 	updatedAtNull := sql.NullTime{}
+	deletedAtNull := sql.NullTime{}
 
 	err := s.Scan(
 		&m.ID,
 		&m.Name,
 		&observationNull,
-		&m.Price,
+		&m.Price.Amount,
+		&m.Price.Currency,
 		&m.CreatedAt,
 		&updatedAtNull,
+		&deletedAtNull,
+		&m.Version,
 	)
 	if err != nil {
 		return &product.Model{}, err
@@ -132,19 +172,263 @@ func scanRowProduct(s scanner) (*product.Model, error) {
 
 	m.Observations = observationNull.String
 	m.UpdatedAt = updatedAtNull.Time
+	m.DeletedAt = deletedAtNull.Time
+
+	return m, nil
+}
+
+// getAllInvoiceHeaders, getInvoiceItems and getAllInvoiceStatusChanges are
+// shared by every sql driver, the scanRow functions read them
+const (
+	getAllInvoiceHeaders = `SELECT id, client, status, kind, reference_id, currency, subtotal, tax,
+	total, created_at, updated_at FROM invoice_headers`
+	getInvoiceItems = `SELECT i.id, i.invoice_header_id, i.product_id, p.name, i.quantity,
+	h.currency, i.unit_price, i.discount, i.total, i.created_at, i.updated_at
+	FROM invoice_items i INNER JOIN products p ON p.id = i.product_id
+	INNER JOIN invoice_headers h ON h.id = i.invoice_header_id`
+	getAllInvoiceStatusChanges = `SELECT id, invoice_header_id, from_status, to_status, reason, created_at
+	FROM invoice_status_changes`
+)
+
+func scanRowInvoiceHeader(s scanner) (*invoiceheader.Model, error) {
+	m := &invoiceheader.Model{}
+	referenceIDNull := sql.NullInt64{}
+	updatedAtNull := sql.NullTime{}
+
+	err := s.Scan(
+		&m.ID,
+		&m.Client,
+		&m.Status,
+		&m.Kind,
+		&referenceIDNull,
+		&m.Currency,
+		&m.Subtotal.Amount,
+		&m.Tax.Amount,
+		&m.Total.Amount,
+		&m.CreateAt,
+		&updatedAtNull,
+	)
+	if err != nil {
+		return &invoiceheader.Model{}, err
+	}
+
+	m.ReferenceID = uint(referenceIDNull.Int64)
+	m.Subtotal.Currency = m.Currency
+	m.Tax.Currency = m.Currency
+	m.Total.Currency = m.Currency
+	m.UpdatedAt = updatedAtNull.Time
 
 	return m, nil
 }
 
+func scanRowInvoiceItem(s scanner) (*invoiceitem.Model, error) {
+	m := &invoiceitem.Model{}
+	updatedAtNull := sql.NullTime{}
+
+	err := s.Scan(
+		&m.ID,
+		&m.InvoiceHeaderID,
+		&m.ProductID,
+		&m.ProductName,
+		&m.Quantity,
+		&m.UnitPrice.Currency,
+		&m.UnitPrice.Amount,
+		&m.Discount.Amount,
+		&m.Total.Amount,
+		&m.CreatedAt,
+		&updatedAtNull,
+	)
+	if err != nil {
+		return &invoiceitem.Model{}, err
+	}
+
+	m.Discount.Currency = m.UnitPrice.Currency
+	m.Total.Currency = m.UnitPrice.Currency
+	m.UpdatedAt = updatedAtNull.Time
+
+	return m, nil
+}
+
+func scanRowStatusChange(s scanner) (*invoiceheader.StatusChange, error) {
+	c := &invoiceheader.StatusChange{}
+	reasonNull := sql.NullString{}
+
+	err := s.Scan(
+		&c.ID,
+		&c.InvoiceHeaderID,
+		&c.From,
+		&c.To,
+		&reasonNull,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return &invoiceheader.StatusChange{}, err
+	}
+
+	c.Reason = reasonNull.String
+
+	return c, nil
+}
+
+// getInvoice reads the header and the items of an invoice
+func getInvoice(ctx context.Context, h invoiceheader.Storage, i invoiceitem.Storage, id uint) (*invoice.Model, error) {
+	header, err := h.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := i.GetByHeaderID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &invoice.Model{Header: header, Items: items}, nil
+}
+
+// listInvoices reads the headers that match the filter and their items,
+// the items of the whole page are read in one query
+func listInvoices(ctx context.Context, h invoiceheader.Storage, i invoiceitem.Storage, f invoiceheader.Filter) (invoice.Models, error) {
+	headers, err := h.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(headers))
+	for n, header := range headers {
+		ids[n] = header.ID
+	}
+	items, err := i.GetByHeaderIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byHeader := make(map[uint]invoiceitem.Models, len(headers))
+	for _, item := range items {
+		byHeader[item.InvoiceHeaderID] = append(byHeader[item.InvoiceHeaderID], item)
+	}
+
+	ms := make(invoice.Models, 0, len(headers))
+	for _, header := range headers {
+		headerItems := byHeader[header.ID]
+		if headerItems == nil {
+			headerItems = make(invoiceitem.Models, 0)
+		}
+		ms = append(ms, &invoice.Model{Header: header, Items: headerItems})
+	}
+
+	return ms, nil
+}
+
+// traced runs fn with a span called name, child of the span of ctx, kv
+// are the attributes of the span
+func traced(ctx context.Context, name string, fn func(context.Context) error, kv ...interface{}) error {
+	ctx, span := trace.Start(ctx, name)
+	span.SetAttributes(kv...)
+	err := fn(ctx)
+	span.End(err)
+	return err
+}
+
+// createInvoice creates the header and the items of an invoice in a
+// transaction, every step has its own span
+func createInvoice(ctx context.Context, db *sql.DB, h invoiceheader.Storage, i invoiceitem.Storage, m *invoice.Model) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "invoice_headers.insert", func(ctx context.Context) error {
+		return h.CreateTx(ctx, tx, m.Header)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = traced(ctx, "invoice_items.insert", func(ctx context.Context) error {
+		return i.CreateTx(ctx, tx, m.Header.ID, m.Items)
+	}, "rows", len(m.Items))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return traced(ctx, "commit", func(context.Context) error {
+		return tx.Commit()
+	})
+}
+
+// changeInvoiceStatus changes the status of an invoice and creates the
+// credit note, when it is not nil, in the same transaction
+func changeInvoiceStatus(ctx context.Context, db *sql.DB, h invoiceheader.Storage, i invoiceitem.Storage, c *invoiceheader.StatusChange, creditNote *invoice.Model) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "invoice_headers.update_status", func(ctx context.Context) error {
+		return h.ChangeStatusTx(ctx, tx, c)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if creditNote != nil {
+		err = traced(ctx, "invoice_headers.insert", func(ctx context.Context) error {
+			return h.CreateTx(ctx, tx, creditNote.Header)
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = traced(ctx, "invoice_items.insert", func(ctx context.Context) error {
+			return i.CreateTx(ctx, tx, creditNote.Header.ID, creditNote.Items)
+		}, "rows", len(creditNote.Items))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return traced(ctx, "commit", func(context.Context) error {
+		return tx.Commit()
+	})
+}
+
 // DAOProduct factory of product.storage
 func DAOProduct(driver Driver) (product.Storage, error) {
-	switch driver {
-	case Postgres:
-		return newPsqlProduct(db), nil
-	case MySQL:
-		return newMySQLProduct(db), nil
+	s, err := opened(driver)
+	if err != nil {
+		return nil, err
+	}
+	return s.Product(), nil
+}
 
-	default:
-		return nil, fmt.Errorf("driver not implemented")
+// DAOInvoiceHeader factory of invoiceheader.Storage
+func DAOInvoiceHeader(driver Driver) (invoiceheader.Storage, error) {
+	s, err := opened(driver)
+	if err != nil {
+		return nil, err
+	}
+	return s.InvoiceHeader(), nil
+}
+
+// DAOInvoiceItem factory of invoiceitem.Storage
+func DAOInvoiceItem(driver Driver) (invoiceitem.Storage, error) {
+	s, err := opened(driver)
+	if err != nil {
+		return nil, err
+	}
+	return s.InvoiceItem(), nil
+}
+
+// DAOInvoice factory of invoice.Storage, header and items are built
+// with the same driver
+func DAOInvoice(driver Driver) (invoice.Storage, error) {
+	s, err := opened(driver)
+	if err != nil {
+		return nil, err
 	}
+	return s.Invoice(), nil
 }
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/migrate"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"github.com/eltaljohn/go-db/pkg/trace"
+	"time"
+)
+
+// Store owns a connection with the db and builds the storages that work
+// over it. The zero value is not usable, use Open
+type Store struct {
+	driver  Driver
+	db      *sql.DB
+	stmts   *stmtCache
+	mem     *MemoryDB
+	log     Logger
+	metrics *Metrics
+	tracer  *trace.Tracer
+}
+
+// Open creates a connection with the db described by c and checks it
+// with a ping. Memory stores get their own empty MemoryDB
+func Open(c Config, opts ...Option) (*Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Store{driver: c.Driver, log: nopLogger{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if c.Driver == Memory {
+		s.mem = NewMemoryDB()
+		s.metrics = newMetrics(Memory, nil)
+		return s, nil
+	}
+
+	driverName, dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("can't open db %s: %w", c.Driver, err)
+	}
+
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+
+	start := time.Now()
+	ctx := context.Background()
+	if c.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+		defer cancel()
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		s.log.ErrorContext(ctx, "storage", "operation", "connect", "driver", string(c.Driver), "error", err.Error())
+		return nil, fmt.Errorf("can't do ping db %s: %w", c.Driver, err)
+	}
+	s.log.InfoContext(ctx, "storage", "operation", "connect", "driver", string(c.Driver), "duration", time.Since(start))
+
+	s.db = db
+	s.stmts = newStmtCache(db)
+	s.metrics = newMetrics(c.Driver, db)
+	return s, nil
+}
+
+// Driver returns the driver of the store
+func (s *Store) Driver() Driver {
+	return s.driver
+}
+
+// DB returns the connection pool of the store, nil for Memory
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the prepared statements and the connection with the db
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.stmts.Close()
+	if dbErr := s.db.Close(); dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+// Migrator returns the migrator of the versioned schema of the store,
+// Memory stores have no schema
+func (s *Store) Migrator() (*migrate.Migrator, error) {
+	return newMigrator(s.db, s.driver)
+}
+
+// newMigrator returns the migrator of the versioned schema of the driver
+// over db
+func newMigrator(db *sql.DB, d Driver) (*migrate.Migrator, error) {
+	switch d {
+	case Postgres:
+		return migrate.New(db, migrate.Postgres, psqlMigrations)
+	case MySQL:
+		return migrate.New(db, migrate.MySQL, mySQLMigrations)
+	case SQLite:
+		return migrate.New(db, migrate.SQLite, sqliteMigrations)
+	default:
+		return nil, fmt.Errorf("driver %s has no schema to migrate", d)
+	}
+}
+
+// events returns the reporter of the operations of the store on table
+func (s *Store) events(table string) events {
+	return events{s.log, s.metrics, s.tracer, s.driver, table}
+}
+
+// Metrics returns the metrics of the operations of the storages of the
+// store and of its connection pool
+func (s *Store) Metrics() *Metrics {
+	return s.metrics
+}
+
+// Product returns the product.Storage of the store
+func (s *Store) Product() product.Storage {
+	return &loggedProduct{s.product(), s.events("products")}
+}
+
+// InvoiceHeader returns the invoiceheader.Storage of the store
+func (s *Store) InvoiceHeader() invoiceheader.Storage {
+	return &loggedInvoiceHeader{s.invoiceHeader(), s.events("invoice_headers")}
+}
+
+// InvoiceItem returns the invoiceitem.Storage of the store
+func (s *Store) InvoiceItem() invoiceitem.Storage {
+	return &loggedInvoiceItem{s.invoiceItem(), s.events("invoice_items")}
+}
+
+// Invoice returns the invoice.Storage of the store, header and items are
+// built over the same connection
+func (s *Store) Invoice() invoice.Storage {
+	h, i := s.invoiceHeader(), s.invoiceItem()
+
+	var next invoice.Storage
+	switch s.driver {
+	case Postgres:
+		next = NewPsqlInvoice(s.db, h, i)
+	case MySQL:
+		next = NewMySQLInvoice(s.db, h, i)
+	case SQLite:
+		next = NewSQLiteInvoice(s.db, h, i)
+	default:
+		next = NewMemoryInvoice(s.mem)
+	}
+	return &loggedInvoice{next, s.events("invoices")}
+}
+
+func (s *Store) product() product.Storage {
+	switch s.driver {
+	case Postgres:
+		return newPsqlProduct(s.db, s.stmts)
+	case MySQL:
+		return newMySQLProduct(s.db, s.stmts)
+	case SQLite:
+		return newSQLiteProduct(s.db, s.stmts)
+	default:
+		return NewMemoryProduct(s.mem)
+	}
+}
+
+func (s *Store) invoiceHeader() invoiceheader.Storage {
+	switch s.driver {
+	case Postgres:
+		return &PsqlInvoiceHeader{s.db, s.stmts}
+	case MySQL:
+		return &MYSQLInvoiceHeader{s.db, s.stmts}
+	case SQLite:
+		return &SQLiteInvoiceHeader{s.db, s.stmts}
+	default:
+		return NewMemoryInvoiceHeader(s.mem)
+	}
+}
+
+func (s *Store) invoiceItem() invoiceitem.Storage {
+	switch s.driver {
+	case Postgres:
+		return &PsqlInvoiceItem{s.db, s.stmts}
+	case MySQL:
+		return &MySQLInvoiceItem{s.db, s.stmts}
+	case SQLite:
+		return &SQLiteInvoiceItem{s.db, s.stmts}
+	default:
+		return NewMemoryInvoiceItem(s.mem)
+	}
+}
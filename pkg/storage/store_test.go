@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eltaljohn/go-db/pkg/invoice"
+	"github.com/eltaljohn/go-db/pkg/invoiceheader"
+	"github.com/eltaljohn/go-db/pkg/invoiceitem"
+	"github.com/eltaljohn/go-db/pkg/money"
+	"github.com/eltaljohn/go-db/pkg/product"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "memory", config: Config{Driver: Memory}},
+		{name: "sqlite", config: Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "go-db.sqlite")}},
+		{name: "sqlite missing dir", config: Config{Driver: SQLite, Path: filepath.Join(t.TempDir(), "no", "go-db.sqlite")}, wantErr: true},
+		{name: "unknown driver", config: Config{Driver: "ORACLE"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Open(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer s.Close()
+
+			if s.Driver() != tt.config.Driver {
+				t.Errorf("Driver = %s, want %s", s.Driver(), tt.config.Driver)
+			}
+
+			ctx := context.Background()
+			for _, m := range []interface{ Migrate(context.Context) error }{s.Product(), s.InvoiceHeader(), s.InvoiceItem()} {
+				if err := m.Migrate(ctx); err != nil {
+					t.Fatalf("Migrate: %v", err)
+				}
+			}
+			if err := s.Product().Create(ctx, &product.Model{Name: "lápiz", Price: money.New(1000, "USD")}); err != nil {
+				t.Fatalf("Create product: %v", err)
+			}
+			m := &invoice.Model{
+				Header: &invoiceheader.Model{Client: "Alexys"},
+				Items:  invoiceitem.Models{{ProductID: 1}},
+			}
+			if err := s.Invoice().Create(ctx, m); err != nil {
+				t.Fatalf("Create invoice: %v", err)
+			}
+		})
+	}
+}
+
+// TestOpenIsolated checks that two stores of the same driver do not share
+// their data
+func TestOpenIsolated(t *testing.T) {
+	a, err := Open(Config{Driver: Memory})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	b, err := Open(Config{Driver: Memory})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := a.Product().Create(context.Background(), &product.Model{Name: "lápiz"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	ms, err := b.Product().GetAll(context.Background())
+	if err != nil || len(ms) != 0 {
+		t.Errorf("GetAll = %d products, %v, want 0", len(ms), err)
+	}
+}
+
+// TestProductEach checks that Each visits every product by id and stops
+// at the first error of fn
+func TestProductEach(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	storages := map[string]product.Storage{
+		"memory": NewMemoryProduct(memoryDB(t)),
+		"sqlite": newSQLiteProduct(db, uncachedStmts(db)),
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				if err := s.Create(ctx, &product.Model{Name: fmt.Sprintf("producto %d", i), Price: money.New(100, "USD")}); err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+			}
+
+			var ids []uint
+			if err := s.Each(ctx, func(m *product.Model) error {
+				ids = append(ids, m.ID)
+				return nil
+			}); err != nil {
+				t.Fatalf("Each: %v", err)
+			}
+			if want := []uint{1, 2, 3, 4}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("ids = %v, want %v", ids, want)
+			}
+
+			stop := errors.New("stop")
+			n := 0
+			err := s.Each(ctx, func(*product.Model) error {
+				if n++; n == 2 {
+					return stop
+				}
+				return nil
+			})
+			if err != stop || n != 2 {
+				t.Errorf("Each = %v after %d products, want %v after 2", err, n, stop)
+			}
+		})
+	}
+}
+
+// TestProductVersion checks the optimistic concurrency of the products:
+// every write increments the version and an update with another one fails
+// with ErrStaleVersion without changing the product
+func TestProductVersion(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	storages := map[string]product.Storage{
+		"memory": NewMemoryProduct(memoryDB(t)),
+		"sqlite": newSQLiteProduct(db, uncachedStmts(db)),
+	}
+
+	version := func(t *testing.T, s product.Storage) uint {
+		t.Helper()
+		m, err := s.GetByID(product.WithDeleted(ctx), 1)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		return m.Version
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			m := &product.Model{Name: "regla", Price: money.New(300, "USD")}
+			if err := s.Create(ctx, m); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if m.Version != 1 {
+				t.Errorf("Create: version = %d, want 1", m.Version)
+			}
+
+			update := &product.Model{ID: 1, Name: "borrador", Price: money.New(500, "USD"), Version: 1}
+			if err := s.Update(ctx, update); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if update.Version != 2 || version(t, s) != 2 {
+				t.Errorf("Update: version = %d, stored %d, want 2", update.Version, version(t, s))
+			}
+
+			stale := &product.Model{ID: 1, Name: "lápiz", Price: money.New(100, "USD"), Version: 1}
+			if err := s.Update(ctx, stale); !errors.Is(err, product.ErrStaleVersion) {
+				t.Errorf("Update stale: err = %v, want %v", err, product.ErrStaleVersion)
+			}
+			if got, err := s.GetByID(ctx, 1); err != nil || got.Name != "borrador" || got.Version != 2 {
+				t.Errorf("after the stale update = %v, %v, want borrador version 2", got, err)
+			}
+
+			// version 0 skips the check
+			if err := s.Update(ctx, &product.Model{ID: 1, Name: "lápiz", Price: money.New(100, "USD")}); err != nil {
+				t.Fatalf("Update without version: %v", err)
+			}
+			if got := version(t, s); got != 3 {
+				t.Errorf("Update without version: version = %d, want 3", got)
+			}
+
+			if err := s.Delete(ctx, 1); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if err := s.Update(ctx, &product.Model{ID: 1, Name: "lápiz", Price: money.New(100, "USD"), Version: 4}); !errors.Is(err, product.ErrNotFound) {
+				t.Errorf("Update deleted: err = %v, want %v", err, product.ErrNotFound)
+			}
+			if err := s.Restore(ctx, 1); err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if got := version(t, s); got != 5 {
+				t.Errorf("after Delete and Restore: version = %d, want 5", got)
+			}
+		})
+	}
+}
+
+// TestProductPatch checks that Patch only changes the fields that are set
+// and checks the version like Update
+func TestProductPatch(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	storages := map[string]product.Storage{
+		"memory": NewMemoryProduct(memoryDB(t)),
+		"sqlite": newSQLiteProduct(db, uncachedStmts(db)),
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			name, observations := "borrador", "de goma"
+			if err := s.Patch(ctx, 1, product.Patch{Name: &name, Observations: &observations, Version: 1}); err != nil {
+				t.Fatalf("Patch: %v", err)
+			}
+			m, err := s.GetByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if m.Name != name || m.Observations != observations || m.Price != money.New(1000, "USD") || m.Version != 2 {
+				t.Errorf("after Patch = %+v, want borrador de goma of 10.00 USD version 2", m)
+			}
+
+			price := money.New(1500, "EUR")
+			if err := s.Patch(ctx, 1, product.Patch{Price: &price, Version: 1}); !errors.Is(err, product.ErrStaleVersion) {
+				t.Errorf("Patch stale: err = %v, want %v", err, product.ErrStaleVersion)
+			}
+			if err := s.Patch(ctx, 1, product.Patch{Price: &price}); err != nil {
+				t.Fatalf("Patch without version: %v", err)
+			}
+			if m, err = s.GetByID(ctx, 1); err != nil || m.Name != name || m.Price != price || m.Version != 3 {
+				t.Errorf("after Patch of the price = %+v, %v, want borrador of 15.00 EUR version 3", m, err)
+			}
+
+			if err := s.Patch(ctx, 1, product.Patch{Version: 3}); !errors.Is(err, product.ErrEmptyPatch) {
+				t.Errorf("Patch empty: err = %v, want %v", err, product.ErrEmptyPatch)
+			}
+			if err := s.Patch(ctx, 9, product.Patch{Name: &name}); !errors.Is(err, product.ErrNotFound) {
+				t.Errorf("Patch missing: err = %v, want %v", err, product.ErrNotFound)
+			}
+			if err := s.Delete(ctx, 1); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if err := s.Patch(ctx, 1, product.Patch{Name: &name}); !errors.Is(err, product.ErrNotFound) {
+				t.Errorf("Patch deleted: err = %v, want %v", err, product.ErrNotFound)
+			}
+		})
+	}
+}
+
+// TestInvoiceManyItems creates an invoice with more items than a chunk of
+// itemsPerInsert and checks that every id is the one of the row of its item
+func TestInvoiceManyItems(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	storages := map[string]invoice.Storage{
+		"memory": NewMemoryInvoice(memoryDB(t)),
+		"sqlite": NewSQLiteInvoice(db, NewSQLiteInvoiceHeader(db), NewSQLiteInvoiceItem(db)),
+	}
+
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			items := make(invoiceitem.Models, itemsPerInsert+1)
+			for i := range items {
+				items[i] = &invoiceitem.Model{ProductID: 1, Quantity: uint(i + 1)}
+			}
+			m := &invoice.Model{Header: &invoiceheader.Model{Client: "Alexys"}, Items: items}
+			if err := s.Create(ctx, m); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			got, err := s.GetByID(ctx, m.Header.ID)
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if len(got.Items) != len(items) {
+				t.Fatalf("%d items, want %d", len(got.Items), len(items))
+			}
+
+			quantities := make(map[uint]uint, len(got.Items))
+			for _, item := range got.Items {
+				quantities[item.ID] = item.Quantity
+			}
+			for i, item := range items {
+				if q, ok := quantities[item.ID]; !ok || q != item.Quantity {
+					t.Fatalf("item %d has the id %d of the quantity %d, want the quantity %d", i, item.ID, q, item.Quantity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package trace records spans of the operations of the services and the
+// storages, in the style of OpenTelemetry. The ended spans are sent to an
+// Exporter
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Exporter receives every span when it ends, it must be safe for
+// concurrent use
+type Exporter interface {
+	Export(*Span)
+}
+
+// Tracer starts spans that are exported to its exporter. A nil *Tracer
+// starts no spans
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a new pointer of Tracer
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{e}
+}
+
+// Start starts a span called name, child of the span of ctx if it has one.
+// The returned context carries the new span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		Name:       name,
+		SpanID:     newID(8),
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		s.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Start starts a span called name with the tracer of the span of ctx, as
+// its child. It starts no span if ctx has none
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+type spanKey struct{}
+
+// FromContext returns the span of ctx, nil if it has none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Span is an operation of a trace. The methods of a nil *Span do nothing
+type Span struct {
+	Name string
+	// TraceID is shared by the spans of a trace, ParentID is empty in the
+	// root span
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]interface{}
+	// Err is the error the operation ended with
+	Err error
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttributes sets the attributes of kv, pairs of a string key and a
+// value
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		if key, ok := kv[i].(string); ok {
+			s.Attributes[key] = kv[i+1]
+		}
+	}
+}
+
+// End ends the span with err, nil if the operation succeeded, and exports
+// it. Only the first call has effect
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.Err = err
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Duration returns how long the span took, zero until it ends
+func (s *Span) Duration() time.Duration {
+	if s == nil || s.EndTime.IsZero() {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InMemoryExporter keeps the exported spans, it is used in tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewInMemoryExporter returns a new pointer of InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export implements interface Exporter
+func (e *InMemoryExporter) Export(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracerStart(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	ctx, parent := tracer.Start(context.Background(), "padre")
+	if FromContext(ctx) != parent {
+		t.Fatal("the context does not carry the span")
+	}
+	childCtx, child := tracer.Start(ctx, "hijo")
+	_, grandchild := Start(childCtx, "nieto")
+
+	if parent.ParentID != "" || len(parent.TraceID) != 32 || len(parent.SpanID) != 16 {
+		t.Errorf("parent = %+v, want a root span", parent)
+	}
+	for _, s := range []*Span{child, grandchild} {
+		if s.TraceID != parent.TraceID {
+			t.Errorf("%s: trace %s, want %s", s.Name, s.TraceID, parent.TraceID)
+		}
+	}
+	if child.ParentID != parent.SpanID || grandchild.ParentID != child.SpanID {
+		t.Errorf("parents = %s, %s, want %s, %s", child.ParentID, grandchild.ParentID, parent.SpanID, child.SpanID)
+	}
+
+	errFail := errors.New("falló")
+	grandchild.SetAttributes("rows", 3, 4, "sin clave")
+	grandchild.End(errFail)
+	child.End(nil)
+	parent.End(nil)
+	// only the first End has effect
+	parent.End(errFail)
+
+	spans := exporter.Spans()
+	if len(spans) != 3 || spans[0] != grandchild || spans[1] != child || spans[2] != parent {
+		t.Fatalf("spans = %v, want the grandchild, the child and the parent", spans)
+	}
+	if grandchild.Err != errFail || grandchild.Attributes["rows"] != 3 || len(grandchild.Attributes) != 1 {
+		t.Errorf("grandchild = %+v", grandchild)
+	}
+	if parent.Err != nil || parent.EndTime.Before(parent.StartTime) {
+		t.Errorf("parent = %+v, want it ended without error", parent)
+	}
+
+	exporter.Reset()
+	if len(exporter.Spans()) != 0 {
+		t.Errorf("spans after Reset = %v", exporter.Spans())
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, s := tracer.Start(context.Background(), "nada")
+	if s != nil || FromContext(ctx) != nil {
+		t.Fatalf("a nil tracer started %+v", s)
+	}
+
+	// the methods of a nil span do nothing
+	s.SetAttributes("rows", 1)
+	s.End(nil)
+	if s.Duration() != 0 {
+		t.Errorf("Duration = %v, want 0", s.Duration())
+	}
+
+	if _, s := Start(context.Background(), "sin padre"); s != nil {
+		t.Errorf("Start without a span in the context = %+v, want nil", s)
+	}
+}